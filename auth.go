@@ -0,0 +1,151 @@
+package webdebugger
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+//the supported password hash algorithm, the hash is auto detected by prefix when verifying
+//
+//  HashBcrypt   $2a$10$...
+//  HashArgon2id $argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>
+//  HashSHA1     40 hex chars, it is legacy and not recommended
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+	HashSHA1     = "sha1"
+)
+
+//HashPassword will hash the password by algorithm
+func HashPassword(algorithm, password string) (hash string, err error) {
+	switch algorithm {
+	case HashBcrypt:
+		var data []byte
+		data, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		hash = string(data)
+	case HashArgon2id:
+		salt := make([]byte, 16)
+		_, err = rand.Read(salt)
+		if err != nil {
+			return
+		}
+		key := argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, 32)
+		hash = fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%v$%v", argon2.Version, 64*1024, 1, 4,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+	case HashSHA1:
+		hash = SHA1([]byte(password))
+	default:
+		err = fmt.Errorf("the hash algorithm %v is not supported", algorithm)
+	}
+	return
+}
+
+//VerifyPassword will verify the password by hash in constant time, the hash algorithm is detected by prefix
+func VerifyPassword(hash, password string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return verifyArgon2id(hash, password)
+	default:
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != 40 {
+			return false
+		}
+		return subtle.ConstantTimeCompare([]byte(strings.ToLower(hash)), []byte(SHA1([]byte(password)))) == 1
+	}
+}
+
+func verifyArgon2id(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false
+	}
+	var version int
+	var memory, iterations uint32
+	var threads uint8
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return false
+	}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads)
+	if err != nil {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) < 1 {
+		return false
+	}
+	other := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+//NewToken will return new random bearer token
+func NewToken() (token string, err error) {
+	data := make([]byte, 24)
+	_, err = rand.Read(data)
+	if err == nil {
+		token = base64.RawURLEncoding.EncodeToString(data)
+	}
+	return
+}
+
+//HashToken will return the sha256 digest of bearer token, the token is random so the slow hash is not required
+func HashToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
+
+//AuthToken is pojo to bearer token configure, the Token is the digest of token by HashToken,
+//the scope is like cert/decord(all host), cert:<host pattern>/decord:<host pattern> or admin, see matchPattern for host pattern
+type AuthToken struct {
+	Name   string   `json:"name"`
+	Token  string   `json:"token"`
+	Scopes []string `json:"scopes"`
+}
+
+//Allow will check the token is allowed to access scope on host
+func (a *AuthToken) Allow(scope, host string) bool {
+	for _, s := range a.Scopes {
+		if s == scope {
+			return true
+		}
+		if strings.HasPrefix(s, scope+":") && matchPattern(strings.TrimPrefix(s, scope+":"), host) < rankNone {
+			return true
+		}
+	}
+	return false
+}
+
+//bearerToken will return the bearer token from Authorization header
+func bearerToken(r *http.Request) (token string, ok bool) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		token, ok = strings.TrimSpace(auth[7:]), true
+	}
+	return
+}
+
+//findToken will return the configured token which is matched by the digest of token
+func findToken(tokens []*AuthToken, token string) (found *AuthToken) {
+	digest := []byte(HashToken(token))
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(strings.ToLower(t.Token)), digest) == 1 {
+			found = t
+			return
+		}
+	}
+	return
+}
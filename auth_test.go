@@ -0,0 +1,85 @@
+package webdebugger
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHashPassword(t *testing.T) {
+	for _, algorithm := range []string{HashBcrypt, HashArgon2id, HashSHA1} {
+		hash, err := HashPassword(algorithm, "123")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !VerifyPassword(hash, "123") || VerifyPassword(hash, "1234") {
+			t.Errorf("%v fail by %v", algorithm, hash)
+			return
+		}
+	}
+	if !VerifyPassword("40bd001563085fc35165329ea1ff5c5ecbdbbeef", "123") {
+		t.Error("error")
+		return
+	}
+	//error
+	_, err := HashPassword("xx", "123")
+	if err == nil {
+		t.Error("error")
+		return
+	}
+	for _, hash := range []string{
+		"", "123", "xx0d001563085fc35165329ea1ff5c5ecbdbbeef", "$2a$xx",
+		"$argon2id$xx", "$argon2id$v=1$m=65536,t=1,p=4$xx$xx", "$argon2id$v=19$m=x$xx$xx",
+		"$argon2id$v=19$m=65536,t=1,p=4$!!$xx", "$argon2id$v=19$m=65536,t=1,p=4$xx$!!",
+	} {
+		if VerifyPassword(hash, "123") {
+			t.Errorf("verify %v", hash)
+			return
+		}
+	}
+}
+
+func TestAuthToken(t *testing.T) {
+	token, _ := NewToken()
+	hash := HashToken(token)
+	if len(hash) != 64 || HashToken(token) != hash {
+		t.Error("error")
+		return
+	}
+	tokens := []*AuthToken{
+		{Name: "all", Token: "xx", Scopes: []string{"cert"}},
+		{Name: "a", Token: hash, Scopes: []string{"cert:*.snows.io:443", "admin"}},
+	}
+	found := findToken(tokens, token)
+	if found == nil || found.Name != "a" {
+		t.Error("error")
+		return
+	}
+	if !found.Allow("cert", "a.snows.io:443") || found.Allow("cert", "a.snows.io:80") || found.Allow("cert", "a.xx.io:443") {
+		t.Error("error")
+		return
+	}
+	if !found.Allow("admin", "") || !tokens[0].Allow("cert", "a.xx.io:443") {
+		t.Error("error")
+		return
+	}
+	bcryptHash, _ := HashPassword(HashBcrypt, token)
+	if findToken([]*AuthToken{{Name: "b", Token: bcryptHash}}, token) != nil {
+		t.Error("error")
+		return
+	}
+	if findToken(tokens, "xx") != nil {
+		t.Error("error")
+		return
+	}
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	if _, ok := bearerToken(req); ok {
+		t.Error("error")
+		return
+	}
+	req.Header.Set("Authorization", "bearer "+token)
+	if v, ok := bearerToken(req); !ok || v != token {
+		t.Error("error")
+		return
+	}
+}
@@ -0,0 +1,364 @@
+package webdebugger
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//the stage of breakpoint to hold
+const (
+	BreakRequest  = "request"
+	BreakResponse = "response"
+)
+
+//the action to resume the held request or response
+//
+//  BreakContinue forward the request or write the response to client with edits
+//  BreakAbort    abort the exchange and response 502 to client
+const (
+	BreakContinue = "continue"
+	BreakAbort    = "abort"
+)
+
+//DefaultBreakTimeout is the default timeout to auto continue the held request or response
+const DefaultBreakTimeout = 60 * time.Second
+
+//DefaultBreakMaxBody is the default max bytes of body to hold
+const DefaultBreakMaxBody = 10 * 1024 * 1024
+
+//Breakpoint is pojo to the breakpoint rule of ConfigHost, the request which is matched by Path/Method/Header is held
+//on request stage before forwarding and on response stage before writing to client until it is resumed or timeout.
+//
+//the Path and Header value pattern can be exact value, wildcard with *, or regexp started with ~,
+//the Header value pattern is empty means the header is exists.
+//the body which is larger than MaxBody is not held, only the header is held and the body is forwarded as is.
+type Breakpoint struct {
+	Path     string            `json:"path"`
+	Method   string            `json:"method"`
+	Header   map[string]string `json:"header"`
+	Request  bool              `json:"request"`
+	Response bool              `json:"response"`
+	Timeout  int               `json:"timeout"`  //the seconds to auto continue, default is 60
+	MaxBody  int               `json:"max_body"` //the max bytes of body to hold, default is DefaultBreakMaxBody
+}
+
+//Match will check the request is matched by breakpoint
+func (b *Breakpoint) Match(r *http.Request) bool {
+	if len(b.Method) > 0 && !strings.EqualFold(b.Method, r.Method) {
+		return false
+	}
+	if len(b.Path) > 0 && !matchValue(b.Path, r.URL.Path) {
+		return false
+	}
+	for name, pattern := range b.Header {
+		vals, ok := r.Header[http.CanonicalHeaderKey(name)]
+		if !ok {
+			return false
+		}
+		if len(pattern) < 1 {
+			continue
+		}
+		matched := false
+		for _, val := range vals {
+			if matchValue(pattern, val) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Breakpoint) timeout() time.Duration {
+	if b.Timeout > 0 {
+		return time.Duration(b.Timeout) * time.Second
+	}
+	return DefaultBreakTimeout
+}
+
+func (b *Breakpoint) maxBody() int {
+	if b.MaxBody > 0 {
+		return b.MaxBody
+	}
+	return DefaultBreakMaxBody
+}
+
+//readHoldBody will read the body to hold by max, the body is omitted when it is larger than max,
+//the read part should be forwarded with the rest of body
+func readHoldBody(body io.Reader, max int) (data []byte, omitted bool, err error) {
+	data, err = ioutil.ReadAll(io.LimitReader(body, int64(max)+1))
+	omitted = len(data) > max
+	return
+}
+
+func matchValue(pattern, value string) bool {
+	if strings.HasPrefix(pattern, "~") {
+		reg := routeRegexp(pattern[1:])
+		return reg != nil && reg.MatchString(value)
+	}
+	if strings.Contains(pattern, "*") {
+		reg := routeRegexp("^" + strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1) + "$")
+		return reg != nil && reg.MatchString(value)
+	}
+	return pattern == value
+}
+
+//breakpoint will return the first breakpoint on stage which is matched by request
+func (c *ConfigHost) breakpoint(stage string, r *http.Request) *Breakpoint {
+	for _, b := range c.Breakpoints {
+		if ((stage == BreakRequest && b.Request) || (stage == BreakResponse && b.Response)) && b.Match(r) {
+			return b
+		}
+	}
+	return nil
+}
+
+//BreakpointHold is pojo to the request or response which is held by breakpoint,
+//the Body is base64 encoded when Encoding is base64, and it is empty when Omitted for larger than max body
+type BreakpointHold struct {
+	ID       uint64      `json:"id"`
+	Stage    string      `json:"stage"`
+	Held     time.Time   `json:"held"`
+	Deadline time.Time   `json:"deadline"`
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Status   int         `json:"status,omitempty"`
+	Header   http.Header `json:"header"`
+	Body     string      `json:"body"`
+	Encoding string      `json:"encoding,omitempty"`
+	Omitted  bool        `json:"body_omitted,omitempty"`
+	resume   chan *BreakpointEdit
+}
+
+//BreakpointEdit is pojo to resume the held request or response, the field is not changed when it is empty,
+//the Method/URL is used on request stage only and the Status is used on response stage only.
+type BreakpointEdit struct {
+	Action   string      `json:"action"`
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Body     *string     `json:"body"`
+	Encoding string      `json:"encoding"`
+}
+
+func (b *BreakpointEdit) body() (body []byte, err error) {
+	if b.Body == nil {
+		return
+	}
+	if b.Encoding == "base64" {
+		body, err = base64.StdEncoding.DecodeString(*b.Body)
+	} else {
+		body = []byte(*b.Body)
+	}
+	return
+}
+
+//Holds will return all request or response which is held by breakpoint
+func (d *Debuger) Holds() (holds []*BreakpointHold) {
+	d.holdsLck.RLock()
+	defer d.holdsLck.RUnlock()
+	holds = []*BreakpointHold{}
+	for _, hold := range d.holds {
+		holds = append(holds, hold)
+	}
+	return
+}
+
+//Resume will resume the held request or response by id with edit
+func (d *Debuger) Resume(id uint64, edit *BreakpointEdit) (err error) {
+	if edit == nil {
+		edit = &BreakpointEdit{}
+	}
+	if len(edit.Action) > 0 && edit.Action != BreakContinue && edit.Action != BreakAbort {
+		err = fmt.Errorf("invalid action %v", edit.Action)
+		return
+	}
+	if _, err = edit.body(); err != nil {
+		return
+	}
+	d.holdsLck.Lock()
+	defer d.holdsLck.Unlock()
+	hold := d.holds[id]
+	if hold == nil {
+		err = fmt.Errorf("hold %v is not found", id)
+		return
+	}
+	delete(d.holds, id)
+	hold.resume <- edit
+	return
+}
+
+//hold will hold until it is resumed, or continue when timeout, or abort when ctx is done
+func (d *Debuger) hold(ctx context.Context, hold *BreakpointHold, timeout time.Duration) (edit *BreakpointEdit) {
+	hold.Held = time.Now()
+	hold.Deadline = hold.Held.Add(timeout)
+	hold.resume = make(chan *BreakpointEdit, 1)
+	d.holdsLck.Lock()
+	d.holdID++
+	hold.ID = d.holdID
+	d.holds[hold.ID] = hold
+	d.holdsLck.Unlock()
+	InfoLog("Debuger hold %v %v %v by breakpoint as %v", hold.Stage, hold.Method, hold.URL, hold.ID)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case edit = <-hold.resume:
+		InfoLog("Debuger hold %v is resumed by %v", hold.ID, edit.Action)
+		return
+	case <-timer.C:
+		InfoLog("Debuger hold %v is timeout, it will be continued", hold.ID)
+		edit = &BreakpointEdit{Action: BreakContinue}
+	case <-ctx.Done():
+		InfoLog("Debuger hold %v is aborted by %v", hold.ID, ctx.Err())
+		edit = &BreakpointEdit{Action: BreakAbort}
+	}
+	d.holdsLck.Lock()
+	if d.holds[hold.ID] == hold {
+		delete(d.holds, hold.ID)
+	} else {
+		//resumed concurrently
+		edit = <-hold.resume
+	}
+	d.holdsLck.Unlock()
+	return
+}
+
+//holdRequest will hold the request by breakpoint and apply the edit, it return false when the request is aborted
+func (d *Debuger) holdRequest(w http.ResponseWriter, r *http.Request, breakpoint *Breakpoint) bool {
+	body, omitted, err := readHoldBody(r.Body, breakpoint.maxBody())
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprintf(w, "read body fail with %v", err)
+		return false
+	}
+	hold := &BreakpointHold{
+		Stage:  BreakRequest,
+		Method: r.Method,
+		URL:    requestScheme(r, connectionState(r)) + "://" + r.Host + r.URL.RequestURI(),
+		Header: r.Header.Clone(),
+	}
+	if omitted {
+		hold.Omitted = true
+	} else {
+		hold.Body, hold.Encoding = harText(body)
+	}
+	edit := d.hold(r.Context(), hold, breakpoint.timeout())
+	if edit.Action == BreakAbort {
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprintf(w, "aborted by breakpoint")
+		return false
+	}
+	if len(edit.Method) > 0 {
+		r.Method = edit.Method
+	}
+	if len(edit.URL) > 0 {
+		if u, err := r.URL.Parse(edit.URL); err == nil {
+			r.URL.Path, r.URL.RawPath, r.URL.RawQuery = u.Path, u.RawPath, u.RawQuery
+		} else {
+			WarnLog("Debuger hold %v parse edited url %v fail with %v", hold.ID, edit.URL, err)
+		}
+	}
+	if edit.Header != nil {
+		r.Header = edit.Header
+	}
+	if edit.Body != nil {
+		body, _ = edit.body()
+	} else if omitted {
+		//forward the rest body as is
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return true
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Del("Content-Length")
+	return true
+}
+
+//holdResponse will hold the response by breakpoint and apply the edit, it return error when the response is aborted,
+//the origin is the scheme and host of client request like https://a.snows.io
+func (d *Debuger) holdResponse(resp *http.Response, breakpoint *Breakpoint, origin string) (err error) {
+	body, omitted, err := readHoldBody(resp.Body, breakpoint.maxBody())
+	if err != nil {
+		resp.Body.Close()
+		return
+	}
+	if !omitted {
+		resp.Body.Close()
+		if decoded, derr := decodeBody(resp.Header, body); derr == nil && len(resp.Header.Get("Content-Encoding")) > 0 {
+			body = decoded
+			resp.Header.Del("Content-Encoding")
+		}
+	}
+	hold := &BreakpointHold{
+		Stage:  BreakResponse,
+		Method: resp.Request.Method,
+		URL:    origin + resp.Request.URL.RequestURI(),
+		Status: resp.StatusCode,
+		Header: resp.Header.Clone(),
+	}
+	if omitted {
+		hold.Omitted = true
+	} else {
+		hold.Body, hold.Encoding = harText(body)
+	}
+	edit := d.hold(resp.Request.Context(), hold, breakpoint.timeout())
+	if edit.Action == BreakAbort {
+		if omitted {
+			resp.Body.Close()
+		}
+		err = fmt.Errorf("aborted by breakpoint")
+		return
+	}
+	if edit.Status > 0 {
+		resp.StatusCode = edit.Status
+		resp.Status = fmt.Sprintf("%d %s", edit.Status, http.StatusText(edit.Status))
+	}
+	if edit.Header != nil {
+		resp.Header = edit.Header
+	}
+	if edit.Body != nil {
+		body, _ = edit.body()
+		if omitted {
+			resp.Body.Close()
+		}
+	} else if omitted {
+		//write the rest body as is
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if !responseBodyAllowed(resp) {
+		//the Content-Length of HEAD is the length of GET, and the 1xx/204/304 has not body
+		return
+	}
+	resp.ContentLength = int64(len(body))
+	resp.TransferEncoding = nil
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return
+}
+
+func responseBodyAllowed(resp *http.Response) bool {
+	if resp.Request != nil && resp.Request.Method == http.MethodHead {
+		return false
+	}
+	return resp.StatusCode >= 200 && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotModified
+}
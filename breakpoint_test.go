@@ -0,0 +1,246 @@
+package webdebugger
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBreakpointMatch(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/user/1?a=1", nil)
+	req.Header.Set("X-Test", "abc")
+	for _, b := range []*Breakpoint{
+		{},
+		{Path: "/api/user/1"},
+		{Path: "/api/*"},
+		{Path: "~^/api/user/[0-9]+$"},
+		{Method: "post"},
+		{Header: map[string]string{"x-test": ""}},
+		{Header: map[string]string{"X-Test": "a*"}},
+		{Path: "/api/*", Method: "POST", Header: map[string]string{"X-Test": "abc"}},
+	} {
+		if !b.Match(req) {
+			t.Errorf("breakpoint:%v", b)
+			return
+		}
+	}
+	for _, b := range []*Breakpoint{
+		{Path: "/api"},
+		{Path: "/user/*"},
+		{Path: "~^/user"},
+		{Path: "~["},
+		{Method: "GET"},
+		{Header: map[string]string{"X-None": ""}},
+		{Header: map[string]string{"X-Test": "x*"}},
+	} {
+		if b.Match(req) {
+			t.Errorf("breakpoint:%v", b)
+			return
+		}
+	}
+	host := &ConfigHost{Breakpoints: []*Breakpoint{{Path: "/a", Request: true}, {Path: "/api/*", Response: true}}}
+	if host.breakpoint(BreakRequest, req) != nil || host.breakpoint(BreakResponse, req) != host.Breakpoints[1] {
+		t.Error("error")
+		return
+	}
+}
+
+func TestBreakpoint(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method == "HEAD" {
+			w.Header().Set("Content-Length", "10")
+			return
+		}
+		if r.URL.Path == "/resp/empty" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.URL.Path == "/gzip" {
+			w.Header().Set("Content-Encoding", "gzip")
+			writer := gzip.NewWriter(w)
+			fmt.Fprintf(writer, "gzip")
+			writer.Close()
+			return
+		}
+		fmt.Fprintf(w, "%v %v %v %v", r.Method, r.URL.RequestURI(), r.Header.Get("X-Test"), string(body))
+	}))
+	defer upstream.Close()
+	debugger := NewDebuger(&Config{
+		Hosts: []*ConfigHost{{
+			Host:    "a.snows.io:443",
+			Forward: upstream.URL,
+			Breakpoints: []*Breakpoint{
+				{Path: "/req/*", Request: true},
+				{Path: "/resp/*", Response: true},
+				{Path: "/gzip", Response: true},
+				{Path: "/timeout", Request: true, Timeout: 1},
+				{Path: "/large/*", Request: true, Response: true, MaxBody: 5},
+			},
+		}},
+		Capture: &CaptureConfig{},
+	})
+	serve := func(ctx context.Context, method, path, body string) (done chan *httptest.ResponseRecorder) {
+		done = make(chan *httptest.ResponseRecorder, 1)
+		req := httptest.NewRequest(method, path, strings.NewReader(body)).WithContext(ctx)
+		req.Host = "a.snows.io"
+		req.RemoteAddr = "a.snows.io:443"
+		req.Header.Set("X-Test", "1")
+		go func() {
+			recorder := httptest.NewRecorder()
+			debugger.ServeHTTP(recorder, req)
+			done <- recorder
+		}()
+		return
+	}
+	waitHold := func() (hold *BreakpointHold) {
+		for i := 0; i < 100; i++ {
+			if holds := debugger.Holds(); len(holds) > 0 {
+				hold = holds[0]
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return
+	}
+	//request edit
+	done := serve(context.Background(), "POST", "/req/a?x=1", "abc")
+	hold := waitHold()
+	if hold == nil || hold.Stage != BreakRequest || hold.Body != "abc" || hold.URL != "http://a.snows.io/req/a?x=1" {
+		t.Errorf("hold:%v", hold)
+		return
+	}
+	body := "xyz"
+	err := debugger.Resume(hold.ID, &BreakpointEdit{Method: "PUT", URL: "/req/b?y=2", Header: http.Header{"X-Test": {"2"}}, Body: &body})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if resp := <-done; resp.Body.String() != "PUT /req/b?y=2 2 xyz" {
+		t.Errorf("resp:%v", resp.Body.String())
+		return
+	}
+	if entries := debugger.Capture.List(); entries[0].Request.URL != "http://a.snows.io/req/b?y=2" {
+		t.Errorf("entries:%v", entries[0].Request.URL)
+		return
+	}
+	//request abort
+	done = serve(context.Background(), "GET", "/req/a", "")
+	hold = waitHold()
+	debugger.Resume(hold.ID, &BreakpointEdit{Action: BreakAbort})
+	if resp := <-done; resp.Code != http.StatusBadGateway {
+		t.Errorf("resp:%v", resp.Code)
+		return
+	}
+	//response edit
+	done = serve(context.Background(), "GET", "/resp/a", "")
+	hold = waitHold()
+	if hold == nil || hold.Stage != BreakResponse || hold.Status != 200 || hold.Body != "GET /resp/a 1 " || hold.URL != "http://a.snows.io/resp/a" {
+		t.Errorf("hold:%v", hold)
+		return
+	}
+	body = "eHl6"
+	debugger.Resume(hold.ID, &BreakpointEdit{Status: 201, Header: http.Header{"X-Resp": {"1"}}, Body: &body, Encoding: "base64"})
+	if resp := <-done; resp.Code != 201 || resp.Body.String() != "xyz" || resp.Header().Get("X-Resp") != "1" {
+		t.Errorf("resp:%v,%v", resp.Code, resp.Body.String())
+		return
+	}
+	//response without body
+	done = serve(context.Background(), "HEAD", "/resp/a", "")
+	hold = waitHold()
+	debugger.Resume(hold.ID, nil)
+	if resp := <-done; resp.Code != 200 || resp.Header().Get("Content-Length") != "10" {
+		t.Errorf("resp:%v,%v", resp.Code, resp.Header())
+		return
+	}
+	done = serve(context.Background(), "GET", "/resp/empty", "")
+	hold = waitHold()
+	debugger.Resume(hold.ID, nil)
+	if resp := <-done; resp.Code != 204 || len(resp.Header().Get("Content-Length")) > 0 {
+		t.Errorf("resp:%v,%v", resp.Code, resp.Header())
+		return
+	}
+	//response gzip
+	done = serve(context.Background(), "GET", "/gzip", "")
+	hold = waitHold()
+	if hold == nil || hold.Body != "gzip" || len(hold.Header.Get("Content-Encoding")) > 0 {
+		t.Errorf("hold:%v", hold)
+		return
+	}
+	debugger.Resume(hold.ID, nil)
+	if resp := <-done; resp.Code != 200 || resp.Body.String() != "gzip" {
+		t.Errorf("resp:%v,%v", resp.Code, resp.Body.String())
+		return
+	}
+	//response abort
+	done = serve(context.Background(), "GET", "/resp/a", "")
+	hold = waitHold()
+	debugger.Resume(hold.ID, &BreakpointEdit{Action: BreakAbort})
+	if resp := <-done; resp.Code != http.StatusBadGateway {
+		t.Errorf("resp:%v", resp.Code)
+		return
+	}
+	//large body is forwarded as is
+	done = serve(context.Background(), "POST", "/large/a", "1234567890")
+	hold = waitHold()
+	if hold == nil || hold.Stage != BreakRequest || !hold.Omitted || len(hold.Body) > 0 {
+		t.Errorf("hold:%v", hold)
+		return
+	}
+	debugger.Resume(hold.ID, nil)
+	hold = waitHold()
+	if hold == nil || hold.Stage != BreakResponse || !hold.Omitted || len(hold.Body) > 0 {
+		t.Errorf("hold:%v", hold)
+		return
+	}
+	debugger.Resume(hold.ID, nil)
+	if resp := <-done; resp.Code != 200 || resp.Body.String() != "POST /large/a 1 1234567890" {
+		t.Errorf("resp:%v,%v", resp.Code, resp.Body.String())
+		return
+	}
+	done = serve(context.Background(), "POST", "/large/a", "1234567890")
+	hold = waitHold()
+	body = "abc"
+	debugger.Resume(hold.ID, &BreakpointEdit{Body: &body})
+	hold = waitHold()
+	debugger.Resume(hold.ID, &BreakpointEdit{Body: &body})
+	if resp := <-done; resp.Code != 200 || resp.Body.String() != "abc" {
+		t.Errorf("resp:%v,%v", resp.Code, resp.Body.String())
+		return
+	}
+	//timeout
+	done = serve(context.Background(), "GET", "/timeout", "")
+	if resp := <-done; resp.Body.String() != "GET /timeout 1 " || len(debugger.Holds()) != 0 {
+		t.Errorf("resp:%v", resp.Body.String())
+		return
+	}
+	//client closed
+	ctx, cancel := context.WithCancel(context.Background())
+	done = serve(ctx, "GET", "/req/a", "")
+	waitHold()
+	cancel()
+	if resp := <-done; resp.Code != http.StatusBadGateway || len(debugger.Holds()) != 0 {
+		t.Errorf("resp:%v", resp.Code)
+		return
+	}
+	//error
+	if err = debugger.Resume(100, nil); err == nil {
+		t.Error("error")
+		return
+	}
+	if err = debugger.Resume(100, &BreakpointEdit{Action: "xx"}); err == nil {
+		t.Error("error")
+		return
+	}
+	body = "%%"
+	if err = debugger.Resume(100, &BreakpointEdit{Body: &body, Encoding: "base64"}); err == nil {
+		t.Error("error")
+		return
+	}
+}
@@ -0,0 +1,349 @@
+package webdebugger
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+//CertAuthority is the root CA to issue leaf certificate
+type CertAuthority struct {
+	Cert    *x509.Certificate
+	Key     crypto.Signer
+	CertPEM []byte
+	KeyPEM  []byte
+}
+
+//GenerateCA will generate new root CA by common name
+func GenerateCA(commonName string) (ca *CertAuthority, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return
+	}
+	serial, err := randSerial()
+	if err != nil {
+		return
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"Web Debugger"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return
+	}
+	ca = &CertAuthority{
+		Key:     key,
+		CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}),
+	}
+	ca.Cert, err = x509.ParseCertificate(der)
+	return
+}
+
+//ParseCA will parse the root CA from pem data
+func ParseCA(certPEM, keyPEM []byte) (ca *CertAuthority, err error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		err = fmt.Errorf("the CA key is not signer")
+		return
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return
+	}
+	if !cert.IsCA {
+		err = fmt.Errorf("the certificate %v is not CA", cert.Subject)
+		return
+	}
+	ca = &CertAuthority{
+		Cert:    cert,
+		Key:     key,
+		CertPEM: certPEM,
+		KeyPEM:  keyPEM,
+	}
+	return
+}
+
+//LoadCA will load the root CA from cert/key file
+func LoadCA(certFile, keyFile string) (ca *CertAuthority, err error) {
+	certPEM, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return
+	}
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return
+	}
+	ca, err = ParseCA(certPEM, keyPEM)
+	return
+}
+
+//LoadOrGenerateCA will load the root CA from cert/key file, it will generate new CA and save to file when file is not exists
+func LoadOrGenerateCA(certFile, keyFile string) (ca *CertAuthority, err error) {
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if !os.IsNotExist(certErr) || !os.IsNotExist(keyErr) {
+		ca, err = LoadCA(certFile, keyFile)
+		return
+	}
+	ca, err = GenerateCA("Web Debugger Root CA")
+	if err != nil {
+		return
+	}
+	err = ca.Save(certFile, keyFile)
+	if err == nil {
+		InfoLog("CertAuthority generate new root CA to %v", certFile)
+	}
+	return
+}
+
+//Save will save the CA to cert/key file
+func (c *CertAuthority) Save(certFile, keyFile string) (err error) {
+	os.MkdirAll(filepath.Dir(certFile), os.ModePerm)
+	os.MkdirAll(filepath.Dir(keyFile), os.ModePerm)
+	err = ioutil.WriteFile(certFile, c.CertPEM, 0644)
+	if err == nil {
+		err = ioutil.WriteFile(keyFile, c.KeyPEM, 0600)
+	}
+	return
+}
+
+//Fingerprint will return the sha256 and sha1 fingerprint of CA certificate, like AB:CD:...
+func (c *CertAuthority) Fingerprint() (sha256Value, sha1Value string) {
+	sha256Sum := sha256.Sum256(c.Cert.Raw)
+	sha1Sum := sha1.Sum(c.Cert.Raw)
+	sha256Value, sha1Value = fingerprint(sha256Sum[:]), fingerprint(sha1Sum[:])
+	return
+}
+
+func fingerprint(sum []byte) string {
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+//Issue will issue new leaf certificate for host, the host is hostname or ip
+func (c *CertAuthority) Issue(host string) (cert *tls.Certificate, err error) {
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: host, Organization: []string{"Web Debugger"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+	cert, err = c.issue(template)
+	return
+}
+
+//IssueClient will issue new client certificate by common name, it is used to auth TLSDecorder on TLSCertCenter
+func (c *CertAuthority) IssueClient(commonName string) (cert *tls.Certificate, err error) {
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName, Organization: []string{"Web Debugger"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	cert, err = c.issue(template)
+	return
+}
+
+func (c *CertAuthority) issue(template *x509.Certificate) (cert *tls.Certificate, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return
+	}
+	template.SerialNumber, err = randSerial()
+	if err != nil {
+		return
+	}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().AddDate(1, 0, 0)
+	if template.NotAfter.After(c.Cert.NotAfter) {
+		template.NotAfter = c.Cert.NotAfter
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	der, err := x509.CreateCertificate(rand.Reader, template, c.Cert, key.Public(), c.Key)
+	if err != nil {
+		return
+	}
+	cert = &tls.Certificate{
+		Certificate: [][]byte{der, c.Cert.Raw},
+		PrivateKey:  key,
+	}
+	cert.Leaf, err = x509.ParseCertificate(der)
+	return
+}
+
+//LoadCertPool will load the certificate pool from pem file
+func LoadCertPool(filename string) (pool *x509.CertPool, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	pool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		err = fmt.Errorf("not certificate found in %v", filename)
+	}
+	return
+}
+
+func randSerial() (serial *big.Int, err error) {
+	serial, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	return
+}
+
+//CADecorderMaxCerts is the default max number of issued leaf certificate cached by CADecorder
+const CADecorderMaxCerts = 1024
+
+//CADecorder provider Decorder to decord connection by leaf certificate which is issued by root CA on the fly,
+//the issued certificate is cached by name and the least recently used one is removed when MaxCerts is reached
+type CADecorder struct {
+	Name     string
+	CACert   string
+	CAKey    string
+	MaxCerts int
+	ca       *CertAuthority
+	certs    map[string]*caCertEntry
+	locker   sync.RWMutex
+}
+
+type caCertEntry struct {
+	*tls.Certificate
+	used time.Time
+}
+
+//NewCADecorder will create new CADecorder
+func NewCADecorder() (decorder *CADecorder) {
+	decorder = &CADecorder{
+		MaxCerts: CADecorderMaxCerts,
+		certs:    map[string]*caCertEntry{},
+		locker:   sync.RWMutex{},
+	}
+	return
+}
+
+//Decord will decord raw connection by host, the certificate is always issued for the host name matched by route,
+//the SNI sent by client is only checked to be same as host name, so the client can't make it issue certificate for other name
+func (c *CADecorder) Decord(host string, raw net.Conn) (conn net.Conn, err error) {
+	err = c.loadCA()
+	if err != nil {
+		InfoLog("CADecorder load CA by cert:%v,key:%v fail with %v", c.CACert, c.CAKey, err)
+		return
+	}
+	name, _ := splitHostPort(host)
+	config := &tls.Config{}
+	config.NextProtos = append(config.NextProtos, "http/1.1")
+	config.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if len(hello.ServerName) > 0 && !strings.EqualFold(hello.ServerName, name) {
+			DebugLog("CADecorder the SNI %v is not matched to %v, using certificate of %v", hello.ServerName, host, name)
+		}
+		return c.certificate(name)
+	}
+	conn = tls.Server(raw, config)
+	return
+}
+
+func (c *CADecorder) loadCA() (err error) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	if c.ca != nil {
+		return
+	}
+	if len(c.CACert) > 0 && len(c.CAKey) > 0 {
+		c.ca, err = LoadOrGenerateCA(c.CACert, c.CAKey)
+	} else {
+		c.ca, err = processCA()
+	}
+	return
+}
+
+var processCAValue *CertAuthority
+var processCAErr error
+var processCAOnce sync.Once
+
+//processCA will return the root CA which is generated once in process
+func processCA() (ca *CertAuthority, err error) {
+	processCAOnce.Do(func() {
+		processCAValue, processCAErr = GenerateCA("Web Debugger Root CA")
+		if processCAErr == nil {
+			WarnLog("CADecorder using generated root CA in memory, it should be configured by ca_cert/ca_key for trusting")
+		}
+	})
+	ca, err = processCAValue, processCAErr
+	return
+}
+
+func (c *CADecorder) certificate(name string) (cert *tls.Certificate, err error) {
+	name = strings.ToLower(name)
+	now := time.Now()
+	c.locker.Lock()
+	entry := c.certs[name]
+	if entry != nil {
+		entry.used = now
+	}
+	ca := c.ca
+	c.locker.Unlock()
+	if entry != nil && now.Add(time.Hour).Before(entry.Leaf.NotAfter) {
+		cert = entry.Certificate
+		return
+	}
+	cert, err = ca.Issue(name)
+	if err != nil {
+		WarnLog("CADecorder issue certificate for %v fail with %v", name, err)
+		return
+	}
+	DebugLog("CADecorder issue certificate for %v", name)
+	c.locker.Lock()
+	if _, having := c.certs[name]; !having && c.MaxCerts > 0 && len(c.certs) >= c.MaxCerts {
+		c.evictCert()
+	}
+	c.certs[name] = &caCertEntry{Certificate: cert, used: now}
+	c.locker.Unlock()
+	return
+}
+
+//evictCert will remove the least recently used certificate, it must be called with locker
+func (c *CADecorder) evictCert() {
+	var oldest string
+	var used time.Time
+	for name, entry := range c.certs {
+		if len(oldest) < 1 || entry.used.Before(used) {
+			oldest, used = name, entry.used
+		}
+	}
+	delete(c.certs, oldest)
+	DebugLog("CADecorder remove certificate of %v by max %v", oldest, c.MaxCerts)
+}
@@ -0,0 +1,117 @@
+package webdebugger
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCADecorder(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wdebugger")
+	defer os.RemoveAll(dir)
+	decorder, err := DefaultDecorderCreator("ca", map[string]interface{}{
+		"name":    "ca",
+		"type":    "CADecorder",
+		"ca_cert": filepath.Join(dir, "ca.crt"),
+		"ca_key":  filepath.Join(dir, "ca.key"),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	handshake := func(decorder Decorder, host, serverName string) (state tls.ConnectionState, err error) {
+		a, b := net.Pipe()
+		defer a.Close()
+		a.SetDeadline(time.Now().Add(time.Second)) //the alert of bad certificate may be blocked on pipe
+		conn, err := decorder.Decord(host, b)
+		if err != nil {
+			return
+		}
+		ca, err := LoadCA(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"))
+		if err != nil {
+			return
+		}
+		pool := x509.NewCertPool()
+		pool.AddCert(ca.Cert)
+		go conn.(*tls.Conn).Handshake()
+		client := tls.Client(a, &tls.Config{RootCAs: pool, ServerName: serverName})
+		err = client.Handshake()
+		state = client.ConnectionState()
+		return
+	}
+	//sni
+	state, err := handshake(decorder, "a.snows.io:443", "a.snows.io")
+	if err != nil || state.PeerCertificates[0].DNSNames[0] != "a.snows.io" {
+		t.Errorf("err:%v", err)
+		return
+	}
+	serial := state.PeerCertificates[0].SerialNumber
+	//cached
+	state, err = handshake(decorder, "a.snows.io:443", "a.snows.io")
+	if err != nil || state.PeerCertificates[0].SerialNumber.Cmp(serial) != 0 {
+		t.Errorf("err:%v", err)
+		return
+	}
+	//sni not matched
+	_, err = handshake(decorder, "a.snows.io:443", "x.snows.io")
+	if err == nil || decorder.(*CADecorder).certs["x.snows.io"] != nil {
+		t.Errorf("err:%v", err)
+		return
+	}
+	//ip without sni
+	state, err = handshake(decorder, "127.0.0.1:443", "127.0.0.1")
+	if err != nil || !state.PeerCertificates[0].IPAddresses[0].Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("err:%v", err)
+		return
+	}
+	//load saved CA
+	decorder2 := NewCADecorder()
+	decorder2.CACert, decorder2.CAKey = filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	_, err = handshake(decorder2, "b.snows.io:443", "b.snows.io")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	//max certs
+	decorder2.MaxCerts = 2
+	decorder2.certificate("c.snows.io")
+	decorder2.certificate("b.snows.io")
+	decorder2.certificate("d.snows.io")
+	if len(decorder2.certs) != 2 || decorder2.certs["c.snows.io"] != nil || decorder2.certs["b.snows.io"] == nil {
+		t.Error("error")
+		return
+	}
+	//process CA
+	ca1, _ := processCA()
+	ca2, _ := processCA()
+	if ca1 == nil || ca1 != ca2 {
+		t.Error("error")
+		return
+	}
+	//error
+	decorder3 := NewCADecorder()
+	decorder3.CACert, decorder3.CAKey = filepath.Join(dir, "ca.crt"), filepath.Join(dir, "none.key")
+	if _, err = decorder3.Decord("a.snows.io:443", nil); err == nil {
+		t.Error("error")
+		return
+	}
+	leaf, _ := ca1.Issue("c.snows.io")
+	if _, err = ParseCA(leaf.Leaf.Raw, nil); err == nil {
+		t.Error("error")
+		return
+	}
+	ioutil.WriteFile(filepath.Join(dir, "leaf.crt"), ca1.CertPEM, 0644)
+	if _, err = LoadCA(filepath.Join(dir, "leaf.crt"), filepath.Join(dir, "none.key")); err == nil {
+		t.Error("error")
+		return
+	}
+	if _, err = LoadCA(filepath.Join(dir, "none.crt"), filepath.Join(dir, "none.key")); err == nil {
+		t.Error("error")
+		return
+	}
+}
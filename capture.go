@@ -0,0 +1,444 @@
+package webdebugger
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//CaptureConfig is pojo to capture configure
+type CaptureConfig struct {
+	Size    int    `json:"size"`     //the max count of exchange kept in memory, default is 1000
+	Dir     string `json:"dir"`      //the directory to save exchange, it is not saved when empty
+	Keep    int    `json:"keep"`     //the max count of exchange kept in Dir, default is 10000
+	MaxBody int    `json:"max_body"` //the max bytes of body to capture, default is 1MB, body is not captured when it is less than zero
+}
+
+//CaptureEntry is pojo to one exchange captured by Debuger
+type CaptureEntry struct {
+	ID       uint64          `json:"id"`
+	Started  time.Time       `json:"started"`
+	Remote   string          `json:"remote"`
+	Host     *ConfigHost     `json:"host,omitempty"`
+	TLS      *CaptureTLS     `json:"tls,omitempty"`
+	Request  *CaptureMessage `json:"request"`
+	Response *CaptureMessage `json:"response"`
+	Timings  CaptureTimings  `json:"timings"`
+	Error    string          `json:"error,omitempty"`
+	ReplayOf uint64          `json:"replay_of,omitempty"`
+}
+
+//CaptureMessage is pojo to captured request or response
+type CaptureMessage struct {
+	Method    string      `json:"method,omitempty"`
+	URL       string      `json:"url,omitempty"`
+	Status    int         `json:"status,omitempty"`
+	Proto     string      `json:"proto"`
+	Header    http.Header `json:"header"`
+	Body      []byte      `json:"body,omitempty"`
+	BodySize  int64       `json:"body_size"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+//CaptureTLS is pojo to the tls connection state of captured exchange
+type CaptureTLS struct {
+	Version            string `json:"version"`
+	CipherSuite        string `json:"cipher_suite"`
+	ServerName         string `json:"server_name"`
+	NegotiatedProtocol string `json:"negotiated_protocol,omitempty"`
+}
+
+//CaptureTimings is pojo to the timings of captured exchange
+//
+//  Send    the duration to read request body from client
+//  Wait    the duration to wait response header from forward after request is sent
+//  Receive the duration to write response body to client
+type CaptureTimings struct {
+	Send    time.Duration `json:"send"`
+	Wait    time.Duration `json:"wait"`
+	Receive time.Duration `json:"receive"`
+}
+
+//Total will return the total duration of exchange
+func (c CaptureTimings) Total() time.Duration {
+	return c.Send + c.Wait + c.Receive
+}
+
+//CaptureStore is the bounded ring to keep captured exchange in memory and save them to Dir optional
+type CaptureStore struct {
+	Size    int
+	Dir     string
+	Keep    int
+	MaxBody int
+	entries []*CaptureEntry
+	next    int
+	count   int
+	lastID  uint64
+	saved   []uint64
+	subs    map[chan *CaptureEntry]bool
+	lck     sync.RWMutex
+}
+
+//NewCaptureStore will create new CaptureStore by configure, the exchange saved in Dir is loaded when Dir is setted
+func NewCaptureStore(config *CaptureConfig) (store *CaptureStore) {
+	store = &CaptureStore{
+		Size:    config.Size,
+		Dir:     config.Dir,
+		Keep:    config.Keep,
+		MaxBody: config.MaxBody,
+		subs:    map[chan *CaptureEntry]bool{},
+		lck:     sync.RWMutex{},
+	}
+	if store.Size < 1 {
+		store.Size = 1000
+	}
+	if store.Keep < 1 {
+		store.Keep = 10000
+	}
+	if store.MaxBody == 0 {
+		store.MaxBody = 1024 * 1024
+	}
+	store.entries = make([]*CaptureEntry, store.Size)
+	if len(store.Dir) > 0 {
+		err := store.load()
+		if err != nil {
+			WarnLog("CaptureStore load exchange from %v fail with %v", store.Dir, err)
+		}
+	}
+	return
+}
+
+func (c *CaptureStore) load() (err error) {
+	files, err := ioutil.ReadDir(c.Dir)
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		id, perr := strconv.ParseUint(strings.TrimSuffix(file.Name(), ".json"), 10, 64)
+		if perr != nil || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		c.saved = append(c.saved, id)
+	}
+	sort.Slice(c.saved, func(i, j int) bool { return c.saved[i] < c.saved[j] })
+	if len(c.saved) > 0 {
+		c.lastID = c.saved[len(c.saved)-1]
+	}
+	from := len(c.saved) - c.Size
+	if from < 0 {
+		from = 0
+	}
+	for _, id := range c.saved[from:] {
+		entry, lerr := c.loadEntry(id)
+		if lerr != nil {
+			WarnLog("CaptureStore load exchange %v fail with %v", id, lerr)
+			continue
+		}
+		c.push(entry)
+	}
+	return
+}
+
+func (c *CaptureStore) loadEntry(id uint64) (entry *CaptureEntry, err error) {
+	entry = &CaptureEntry{}
+	err = ReadJSON(filepath.Join(c.Dir, fmt.Sprintf("%v.json", id)), entry)
+	return
+}
+
+//push will push entry to ring, it must be called in lck
+func (c *CaptureStore) push(entry *CaptureEntry) {
+	c.entries[c.next] = entry
+	c.next = (c.next + 1) % c.Size
+	if c.count < c.Size {
+		c.count++
+	}
+}
+
+//Add will add the exchange to store and assign id to it
+func (c *CaptureStore) Add(entry *CaptureEntry) {
+	c.lck.Lock()
+	c.lastID++
+	entry.ID = c.lastID
+	c.push(entry)
+	for sub := range c.subs {
+		select {
+		case sub <- entry:
+		default:
+			WarnLog("CaptureStore the subscriber is slow, exchange %v is dropped", entry.ID)
+		}
+	}
+	c.lck.Unlock()
+	if len(c.Dir) > 0 {
+		err := c.save(entry)
+		if err != nil {
+			WarnLog("CaptureStore save exchange %v to %v fail with %v", entry.ID, c.Dir, err)
+		}
+	}
+}
+
+func (c *CaptureStore) save(entry *CaptureEntry) (err error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	os.MkdirAll(c.Dir, os.ModePerm)
+	err = writeFileAtomic(filepath.Join(c.Dir, fmt.Sprintf("%v.json", entry.ID)), data, 0600)
+	if err != nil {
+		return
+	}
+	c.lck.Lock()
+	c.saved = append(c.saved, entry.ID)
+	var removed []uint64
+	if len(c.saved) > c.Keep {
+		removed = c.saved[:len(c.saved)-c.Keep]
+		c.saved = append([]uint64{}, c.saved[len(c.saved)-c.Keep:]...)
+	}
+	c.lck.Unlock()
+	for _, id := range removed {
+		os.Remove(filepath.Join(c.Dir, fmt.Sprintf("%v.json", id)))
+	}
+	return
+}
+
+//List will return all exchange in memory from oldest to newest
+func (c *CaptureStore) List() (entries []*CaptureEntry) {
+	c.lck.RLock()
+	defer c.lck.RUnlock()
+	entries = make([]*CaptureEntry, 0, c.count)
+	for i := 0; i < c.count; i++ {
+		entries = append(entries, c.entries[(c.next-c.count+i+c.Size)%c.Size])
+	}
+	return
+}
+
+//Find will return the exchange by id from memory, or from Dir when it is not in memory
+func (c *CaptureStore) Find(id uint64) (entry *CaptureEntry, err error) {
+	c.lck.RLock()
+	for i := 0; i < c.count; i++ {
+		if e := c.entries[i]; e.ID == id {
+			entry = e
+			break
+		}
+	}
+	c.lck.RUnlock()
+	if entry != nil {
+		return
+	}
+	if len(c.Dir) < 1 {
+		err = fmt.Errorf("exchange %v is not found", id)
+		return
+	}
+	entry, err = c.loadEntry(id)
+	return
+}
+
+//Subscribe will return the channel to receive new exchange, the exchange is dropped when the channel is full,
+//the cancel must be called after done
+func (c *CaptureStore) Subscribe() (entries <-chan *CaptureEntry, cancel func()) {
+	sub := make(chan *CaptureEntry, 100)
+	c.lck.Lock()
+	c.subs[sub] = true
+	c.lck.Unlock()
+	entries = sub
+	cancel = func() {
+		c.lck.Lock()
+		if c.subs[sub] {
+			delete(c.subs, sub)
+			close(sub)
+		}
+		c.lck.Unlock()
+	}
+	return
+}
+
+//Clear will remove all exchange in memory
+func (c *CaptureStore) Clear() {
+	c.lck.Lock()
+	c.entries = make([]*CaptureEntry, c.Size)
+	c.next, c.count = 0, 0
+	c.lck.Unlock()
+}
+
+//requestScheme will return https when the request is received on decorded tls connection or replayed by https url
+func requestScheme(r *http.Request, state *tls.ConnectionState) string {
+	if state != nil || r.TLS != nil || r.URL.Scheme == "https" {
+		return "https"
+	}
+	return "http"
+}
+
+//begin will create the capturing exchange for request, the request body is captured when it is read
+func (c *CaptureStore) begin(host *ConfigHost, r *http.Request, state *tls.ConnectionState) (exchange *captureExchange) {
+	started := time.Now()
+	entry := &CaptureEntry{
+		Started: started,
+		Remote:  r.RemoteAddr,
+		Request: &CaptureMessage{
+			Method: r.Method,
+			URL:    requestScheme(r, state) + "://" + r.Host + r.URL.RequestURI(),
+			Proto:  r.Proto,
+			Header: r.Header.Clone(),
+		},
+		Response: &CaptureMessage{},
+	}
+	entry.ReplayOf, _ = r.Context().Value(replayContextKey{}).(uint64)
+	if host != nil {
+		copied := *host
+		entry.Host = &copied
+	}
+	if state != nil {
+		entry.TLS = &CaptureTLS{
+			Version:            tls.VersionName(state.Version),
+			CipherSuite:        tls.CipherSuiteName(state.CipherSuite),
+			ServerName:         state.ServerName,
+			NegotiatedProtocol: state.NegotiatedProtocol,
+		}
+	}
+	exchange = &captureExchange{
+		entry:   entry,
+		request: &captureBody{message: entry.Request, limit: c.MaxBody},
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		exchange.request.ReadCloser = r.Body
+		r.Body = exchange.request
+	}
+	return
+}
+
+//finish will complete the timings of exchange and add it to store
+func (c *CaptureStore) finish(exchange *captureExchange) {
+	entry := exchange.entry
+	done := time.Now()
+	sent := exchange.request.done
+	if sent.IsZero() {
+		sent = entry.Started
+	}
+	header := exchange.header
+	if header.IsZero() {
+		header = done
+	}
+	if header.Before(sent) {
+		sent = header
+	}
+	entry.Timings.Send = sent.Sub(entry.Started)
+	entry.Timings.Wait = header.Sub(sent)
+	entry.Timings.Receive = done.Sub(header)
+	if exchange.err != nil {
+		entry.Error = exchange.err.Error()
+	}
+	c.Add(entry)
+}
+
+type captureExchange struct {
+	entry   *CaptureEntry
+	request *captureBody
+	header  time.Time
+	proto   string
+	err     error
+}
+
+//captureBody is the request body wrapper to capture the body when it is read
+type captureBody struct {
+	io.ReadCloser
+	message *CaptureMessage
+	limit   int
+	done    time.Time
+}
+
+func (c *captureBody) Read(p []byte) (n int, err error) {
+	n, err = c.ReadCloser.Read(p)
+	c.message.capture(p[:n], c.limit)
+	if err == io.EOF && c.done.IsZero() {
+		c.done = time.Now()
+	}
+	return
+}
+
+//captureWriter is the http.ResponseWriter wrapper to capture the response which is written to client
+type captureWriter struct {
+	http.ResponseWriter
+	exchange *captureExchange
+	limit    int
+}
+
+//WriteHeader will capture the final response header, the informational response like 100/103 is skipped
+func (c *captureWriter) WriteHeader(status int) {
+	if c.exchange.header.IsZero() && (status >= 200 || status == http.StatusSwitchingProtocols) {
+		c.exchange.header = time.Now()
+		response := c.exchange.entry.Response
+		response.Status = status
+		response.Proto = c.exchange.proto
+		if len(response.Proto) < 1 {
+			response.Proto = "HTTP/1.1"
+		}
+		response.Header = c.ResponseWriter.Header().Clone()
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *captureWriter) Write(p []byte) (n int, err error) {
+	if c.exchange.header.IsZero() {
+		c.WriteHeader(200)
+	}
+	n, err = c.ResponseWriter.Write(p)
+	c.exchange.entry.Response.capture(p[:n], c.limit)
+	return
+}
+
+func (c *captureWriter) Flush() {
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (c *captureWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+func (c *CaptureMessage) capture(p []byte, limit int) {
+	c.BodySize += int64(len(p))
+	if limit < 0 {
+		return
+	}
+	remain := limit - len(c.Body)
+	if remain < len(p) {
+		c.Truncated = c.Truncated || len(p) > 0
+		p = p[:remain]
+	}
+	c.Body = append(c.Body, p...)
+}
+
+//decodeBody will decompress the body by Content-Encoding in header, it return the raw body when it is not compressed
+func decodeBody(header http.Header, body []byte) (decoded []byte, err error) {
+	var reader io.Reader
+	switch strings.ToLower(header.Get("Content-Encoding")) {
+	case "gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		reader = flate.NewReader(bytes.NewReader(body))
+	default:
+		decoded = body
+		return
+	}
+	if err == nil {
+		decoded, err = ioutil.ReadAll(reader)
+	}
+	return
+}
@@ -0,0 +1,223 @@
+package webdebugger
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCaptureStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wdebugger")
+	defer os.RemoveAll(dir)
+	store := NewCaptureStore(&CaptureConfig{Size: 3, Dir: dir, Keep: 4})
+	for i := 0; i < 5; i++ {
+		store.Add(&CaptureEntry{Request: &CaptureMessage{}, Response: &CaptureMessage{}})
+	}
+	entries := store.List()
+	if len(entries) != 3 || entries[0].ID != 3 || entries[2].ID != 5 {
+		t.Errorf("entries:%v", entries)
+		return
+	}
+	if entry, err := store.Find(4); err != nil || entry.ID != 4 {
+		t.Error(err)
+		return
+	}
+	//from disk
+	if entry, err := store.Find(2); err != nil || entry.ID != 2 {
+		t.Error(err)
+		return
+	}
+	if _, err := store.Find(1); err == nil {
+		t.Error("error")
+		return
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 4 {
+		t.Errorf("files:%v", len(files))
+		return
+	}
+	//reload
+	store = NewCaptureStore(&CaptureConfig{Size: 2, Dir: dir})
+	entries = store.List()
+	if len(entries) != 2 || entries[0].ID != 4 || entries[1].ID != 5 {
+		t.Errorf("entries:%v", entries)
+		return
+	}
+	store.Add(&CaptureEntry{Request: &CaptureMessage{}, Response: &CaptureMessage{}})
+	if entries = store.List(); entries[1].ID != 6 {
+		t.Errorf("entries:%v", entries)
+		return
+	}
+	store.Clear()
+	if len(store.List()) != 0 {
+		t.Error("error")
+		return
+	}
+	//memory only
+	store = NewCaptureStore(&CaptureConfig{})
+	if _, err := store.Find(1); err == nil {
+		t.Error("error")
+		return
+	}
+	//invalid dir
+	ioutil.WriteFile(filepath.Join(dir, "xx"), []byte("xx"), 0600)
+	store = NewCaptureStore(&CaptureConfig{Dir: filepath.Join(dir, "xx")})
+	store.Add(&CaptureEntry{Request: &CaptureMessage{}, Response: &CaptureMessage{}})
+	if len(store.List()) != 1 {
+		t.Error("error")
+		return
+	}
+}
+
+func TestCaptureExchange(t *testing.T) {
+	store := NewCaptureStore(&CaptureConfig{MaxBody: 4})
+	host := &ConfigHost{Host: "a.snows.io:443", Forward: "http://127.0.0.1:10021"}
+	req := httptest.NewRequest("POST", "/abc?a=1", strings.NewReader("123456"))
+	req.Host = "a.snows.io"
+	exchange := store.begin(host, req, &tls.ConnectionState{Version: tls.VersionTLS12})
+	ioutil.ReadAll(req.Body)
+	recorder := httptest.NewRecorder()
+	w := &captureWriter{ResponseWriter: recorder, exchange: exchange, limit: store.MaxBody}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok"))
+	w.Flush()
+	store.finish(exchange)
+	entry, err := store.Find(1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if entry.Request.URL != "https://a.snows.io/abc?a=1" || string(entry.Request.Body) != "1234" ||
+		entry.Request.BodySize != 6 || !entry.Request.Truncated {
+		t.Errorf("request:%v", entry.Request)
+		return
+	}
+	if entry.Response.Status != 200 || string(entry.Response.Body) != "ok" || entry.Response.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("response:%v", entry.Response)
+		return
+	}
+	if entry.Host.Host != host.Host || entry.Timings.Total() <= 0 {
+		t.Errorf("entry:%v", entry)
+		return
+	}
+	//no body
+	req = httptest.NewRequest("GET", "/", nil)
+	exchange = store.begin(nil, req, nil)
+	store.finish(exchange)
+	if entry, _ = store.Find(2); entry.Response.Status != 0 || entry.Host != nil || entry.Request.URL != "http://example.com/" {
+		t.Errorf("entry:%v", entry)
+		return
+	}
+}
+
+func TestCaptureDebuger(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/early" {
+			w.Header().Set("Link", "</a.css>; rel=preload")
+			w.WriteHeader(http.StatusEarlyHints)
+		}
+		fmt.Fprintf(w, "ok")
+	}))
+	defer upstream.Close()
+	//the upstream responses by http/1.0
+	legacy, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer legacy.Close()
+	go func() {
+		for {
+			conn, err := legacy.Accept()
+			if err != nil {
+				return
+			}
+			http.ReadRequest(bufio.NewReader(conn))
+			conn.Write([]byte("HTTP/1.0 200 OK\r\nContent-Length: 6\r\n\r\nlegacy"))
+			conn.Close()
+		}
+	}()
+	debugger := NewDebuger(&Config{
+		Hosts: []*ConfigHost{
+			{Host: "a.snows.io:443", Decorder: "ca", Forward: upstream.URL},
+			{Host: "b.snows.io:443", Decorder: "ca", Forward: "http://" + legacy.Addr().String()},
+		},
+		Decorder: []map[string]interface{}{{"name": "ca", "type": "CADecorder"}},
+		Capture:  &CaptureConfig{},
+	})
+	go debugger.Serve()
+	client := &http.Client{
+		Transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				a, b, _ := CreatePipeConn()
+				_, err := debugger.ProcConn(addr, a)
+				return b, err
+			},
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	for _, uri := range []string{"https://a.snows.io", "https://a.snows.io/early", "https://b.snows.io"} {
+		if _, err := doGet(client, uri); err != nil {
+			t.Errorf("uri:%v,err:%v", uri, err)
+			return
+		}
+	}
+	entries := debugger.Capture.List()
+	for i := 0; i < 100 && len(entries) < 3; i++ { //the entry is added after response is sent
+		time.Sleep(10 * time.Millisecond)
+		entries = debugger.Capture.List()
+	}
+	if len(entries) != 3 {
+		t.Errorf("entries:%v", entries)
+		return
+	}
+	entry := entries[0]
+	if entry.Response.Status != 200 || string(entry.Response.Body) != "ok" || entry.Response.Proto != "HTTP/1.1" ||
+		entry.TLS == nil || entry.Request.URL != "https://a.snows.io/" {
+		t.Errorf("entry:%v", entry)
+		return
+	}
+	//1xx is skipped
+	if entry = entries[1]; entry.Response.Status != 200 || string(entry.Response.Body) != "ok" {
+		t.Errorf("entry:%v", entry.Response)
+		return
+	}
+	//proto of upstream
+	if entry = entries[2]; entry.Response.Status != 200 || string(entry.Response.Body) != "legacy" || entry.Response.Proto != "HTTP/1.0" {
+		t.Errorf("entry:%v", entry.Response)
+		return
+	}
+}
+
+func TestDecodeBody(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	writer := gzip.NewWriter(buf)
+	writer.Write([]byte("abc"))
+	writer.Close()
+	header := http.Header{}
+	header.Set("Content-Encoding", "gzip")
+	if data, err := decodeBody(header, buf.Bytes()); err != nil || string(data) != "abc" {
+		t.Error(err)
+		return
+	}
+	if _, err := decodeBody(header, []byte("abc")); err == nil {
+		t.Error("error")
+		return
+	}
+	header.Set("Content-Encoding", "deflate")
+	if _, err := decodeBody(header, []byte("abc")); err == nil {
+		t.Error("error")
+		return
+	}
+	header.Del("Content-Encoding")
+	if data, err := decodeBody(header, []byte("abc")); err != nil || string(data) != "abc" {
+		t.Error(err)
+		return
+	}
+}
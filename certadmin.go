@@ -0,0 +1,316 @@
+package webdebugger
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var certFileReplacer = regexp.MustCompile("[^a-zA-Z0-9.-]")
+
+//admin will proc the admin api by token with admin scope
+//
+//  GET    /admin/certs            list all host configure without password/psk
+//  POST   /admin/certs            add host configure by json {"host":"","cert_pem":"","key_pem":"",...}
+//  PUT    /admin/certs?host=xx    rotate the cert/key of host by json {"cert_pem":"","key_pem":""}
+//  DELETE /admin/certs?host=xx    delete the host configure
+func (t *TLSCertCenter) admin(w http.ResponseWriter, r *http.Request) {
+	token, bearer := bearerToken(r)
+	if !bearer {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="Web Debugger"`)
+		w.WriteHeader(401)
+		w.Write([]byte("Token Required.\n"))
+		return
+	}
+	found := findToken(t.Tokens, token)
+	if found == nil || !found.Allow("admin", "") {
+		WarnLog("TlsCertCenter the admin request from %v is denied", r.RemoteAddr)
+		w.WriteHeader(403)
+		w.Write([]byte("Scope Required.\n"))
+		return
+	}
+	if r.URL.Path != "/admin/certs" {
+		w.WriteHeader(404)
+		fmt.Fprintf(w, "%v is not supported", r.URL.Path)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		t.listCerts(w, r)
+	case "POST":
+		t.addCert(w, r)
+	case "PUT":
+		t.rotateCert(w, r)
+	case "DELETE":
+		t.deleteCert(w, r)
+	default:
+		w.WriteHeader(405)
+		fmt.Fprintf(w, "%v is not allowed", r.Method)
+	}
+}
+
+func (t *TLSCertCenter) listCerts(w http.ResponseWriter, r *http.Request) {
+	t.certsLck.RLock()
+	certs := []map[string]interface{}{}
+	for _, conf := range t.certs {
+		info := map[string]interface{}{}
+		for k, v := range conf {
+			if k != "password" && k != "psk" {
+				info[k] = v
+			}
+		}
+		if psk, _ := conf["psk"].(string); len(psk) > 0 {
+			info["psk"] = true
+		}
+		if data, _, err := t.loadCert(conf); err == nil {
+			if leaf, err := parseLeaf(data); err == nil {
+				info["subject"] = leaf.Subject.String()
+				info["dns_names"] = leaf.DNSNames
+				info["not_after"] = leaf.NotAfter
+			}
+		}
+		certs = append(certs, info)
+	}
+	t.certsLck.RUnlock()
+	writeJSON(w, 200, certs)
+}
+
+func (t *TLSCertCenter) addCert(w http.ResponseWriter, r *http.Request) {
+	conf := map[string]interface{}{}
+	err := json.NewDecoder(r.Body).Decode(&conf)
+	if err != nil {
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "parse body fail with %v", err)
+		return
+	}
+	host, _ := conf["host"].(string)
+	certPEM, _ := conf["cert_pem"].(string)
+	keyPEM, _ := conf["key_pem"].(string)
+	delete(conf, "cert_pem")
+	delete(conf, "key_pem")
+	if len(host) < 1 {
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "host is required")
+		return
+	}
+	t.certsLck.Lock()
+	defer t.certsLck.Unlock()
+	if t.findCert(host) >= 0 {
+		w.WriteHeader(409)
+		fmt.Fprintf(w, "host %v is exists", host)
+		return
+	}
+	restore := t.backupCert(host)
+	err = t.saveCert(conf, host, certPEM, keyPEM)
+	if err != nil {
+		restore()
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "save cert fail with %v", err)
+		return
+	}
+	certs := append(append([]map[string]interface{}{}, t.certs...), conf)
+	if !t.persistCerts(w, certs) {
+		restore()
+		return
+	}
+	InfoLog("TlsCertCenter add host %v by admin from %v", host, r.RemoteAddr)
+	writeJSON(w, 200, map[string]interface{}{"host": host})
+}
+
+func (t *TLSCertCenter) rotateCert(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Query().Get("host")
+	body := map[string]interface{}{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "parse body fail with %v", err)
+		return
+	}
+	certPEM, _ := body["cert_pem"].(string)
+	keyPEM, _ := body["key_pem"].(string)
+	t.certsLck.Lock()
+	defer t.certsLck.Unlock()
+	index := t.findCert(host)
+	if index < 0 {
+		w.WriteHeader(404)
+		fmt.Fprintf(w, "host config is not exists")
+		return
+	}
+	conf := map[string]interface{}{}
+	for k, v := range t.certs[index] {
+		conf[k] = v
+	}
+	restore := t.backupCert(host)
+	err = t.saveCert(conf, host, certPEM, keyPEM)
+	if err != nil {
+		restore()
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "save cert fail with %v", err)
+		return
+	}
+	certs := append([]map[string]interface{}{}, t.certs...)
+	certs[index] = conf
+	if !t.persistCerts(w, certs) {
+		restore()
+		return
+	}
+	InfoLog("TlsCertCenter rotate host %v by admin from %v", host, r.RemoteAddr)
+	writeJSON(w, 200, map[string]interface{}{"host": host})
+}
+
+func (t *TLSCertCenter) deleteCert(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Query().Get("host")
+	t.certsLck.Lock()
+	defer t.certsLck.Unlock()
+	index := t.findCert(host)
+	if index < 0 {
+		w.WriteHeader(404)
+		fmt.Fprintf(w, "host config is not exists")
+		return
+	}
+	removed := t.certs[index]
+	certs := append(append([]map[string]interface{}{}, t.certs[:index]...), t.certs[index+1:]...)
+	if !t.persistCerts(w, certs) {
+		return
+	}
+	//only remove the cert/key which is saved by admin
+	if file, _ := removed["cert"].(string); len(file) < 1 && t.Store != nil {
+		if err := t.Store.Delete(host); err != nil {
+			WarnLog("TlsCertCenter delete %v from store fail with %v", host, err)
+		}
+	} else if len(t.CertDir) > 0 {
+		for _, key := range []string{"cert", "key"} {
+			if file, _ := removed[key].(string); len(file) > 0 && filepath.Dir(file) == filepath.Clean(t.CertDir) {
+				os.Remove(file)
+			}
+		}
+	}
+	InfoLog("TlsCertCenter delete host %v by admin from %v", host, r.RemoteAddr)
+	writeJSON(w, 200, map[string]interface{}{"host": host})
+}
+
+//findCert will return the index of host configure which host is equal to host, it must be called in certsLck
+func (t *TLSCertCenter) findCert(host string) int {
+	for i, conf := range t.certs {
+		if h, _ := conf["host"].(string); len(host) > 0 && h == host {
+			return i
+		}
+	}
+	return -1
+}
+
+//persistCerts will persist certs and replace the host configure when it is success, it must be called in certsLck
+func (t *TLSCertCenter) persistCerts(w http.ResponseWriter, certs []map[string]interface{}) bool {
+	if t.Persist != nil {
+		if err := t.Persist(certs); err != nil {
+			WarnLog("TlsCertCenter persist host config fail with %v", err)
+			w.WriteHeader(500)
+			fmt.Fprintf(w, "persist host config fail with %v", err)
+			return false
+		}
+	}
+	t.certs = certs
+	return true
+}
+
+//saveCert will verify the cert/key and save it to Store or CertDir, the cert/key file of conf is updated
+func (t *TLSCertCenter) saveCert(conf map[string]interface{}, host, certPEM, keyPEM string) (err error) {
+	_, err = tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return
+	}
+	if t.Store != nil {
+		err = t.Store.Save(host, []byte(certPEM), []byte(keyPEM))
+		delete(conf, "cert")
+		delete(conf, "key")
+		return
+	}
+	certFile, keyFile := t.certFiles(host)
+	if len(t.CertDir) > 0 {
+		os.MkdirAll(t.CertDir, os.ModePerm)
+	}
+	err = writeFileAtomic(certFile, []byte(certPEM), 0644)
+	if err == nil {
+		err = writeFileAtomic(keyFile, []byte(keyPEM), 0600)
+	}
+	conf["cert"], conf["key"] = certFile, keyFile
+	return
+}
+
+//backupCert will backup the cert/key of host which is overwritten by saveCert,
+//the returned restore func will recover it or remove the saved cert/key when it is not exists before
+func (t *TLSCertCenter) backupCert(host string) (restore func()) {
+	if t.Store != nil {
+		certPEM, keyPEM, loadErr := t.Store.Load(host)
+		restore = func() {
+			var err error
+			if loadErr != nil {
+				err = t.Store.Delete(host)
+			} else {
+				err = t.Store.Save(host, certPEM, keyPEM)
+			}
+			if err != nil {
+				WarnLog("TlsCertCenter restore %v on store fail with %v", host, err)
+			}
+		}
+		return
+	}
+	certFile, keyFile := t.certFiles(host)
+	certPEM, certErr := ioutil.ReadFile(certFile)
+	keyPEM, keyErr := ioutil.ReadFile(keyFile)
+	restore = func() {
+		if certErr == nil && keyErr == nil {
+			writeFileAtomic(certFile, certPEM, 0644)
+			writeFileAtomic(keyFile, keyPEM, 0600)
+		} else {
+			os.Remove(certFile)
+			os.Remove(keyFile)
+		}
+	}
+	return
+}
+
+//certFiles will return the cert/key file of host which is saved by admin in CertDir
+func (t *TLSCertCenter) certFiles(host string) (certFile, keyFile string) {
+	name := certFileReplacer.ReplaceAllString(host, "_")
+	certFile, keyFile = filepath.Join(t.CertDir, name+".crt"), filepath.Join(t.CertDir, name+".key")
+	return
+}
+
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) (err error) {
+	tmp := filename + ".tmp"
+	err = ioutil.WriteFile(tmp, data, perm)
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	return
+}
+
+func parseLeaf(certPEM []byte) (leaf *x509.Certificate, err error) {
+	for {
+		var block *pem.Block
+		block, certPEM = pem.Decode(certPEM)
+		if block == nil {
+			err = fmt.Errorf("not certificate found")
+			return
+		}
+		if block.Type == "CERTIFICATE" {
+			leaf, err = x509.ParseCertificate(block.Bytes)
+			return
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
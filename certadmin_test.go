@@ -0,0 +1,202 @@
+package webdebugger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTLSCertCenterAdmin(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wdebugger")
+	defer os.RemoveAll(dir)
+	ca, _ := GenerateCA("test")
+	certA, _ := ca.Issue("a.snows.io")
+	certFileA, keyFileA := writeTestCert(dir, "a", certA)
+	certPEM, _ := ioutil.ReadFile(certFileA)
+	keyPEM, _ := ioutil.ReadFile(keyFileA)
+	center := NewTLSCertCenter(map[string]interface{}{"host": "a.snows.io:443", "cert": certFileA, "key": keyFileA, "psk": "123"})
+	center.CertDir = filepath.Join(dir, "certs")
+	adminToken, _ := NewToken()
+	adminHash := HashToken(adminToken)
+	certToken, _ := NewToken()
+	certHash := HashToken(certToken)
+	center.Tokens = []*AuthToken{
+		{Name: "admin", Token: adminHash, Scopes: []string{"admin"}},
+		{Name: "cert", Token: certHash, Scopes: []string{"cert"}},
+	}
+	var persisted []map[string]interface{}
+	var persistErr error
+	center.Persist = func(certs []map[string]interface{}) error {
+		if persistErr == nil {
+			persisted = certs
+		}
+		return persistErr
+	}
+	ts := httptest.NewServer(center)
+	defer ts.Close()
+	request := func(method, path, token string, body interface{}) (status int, data []byte) {
+		var reader *bytes.Reader
+		if body != nil {
+			raw, _ := json.Marshal(body)
+			reader = bytes.NewReader(raw)
+		} else {
+			reader = bytes.NewReader(nil)
+		}
+		req, _ := http.NewRequest(method, ts.URL+path, reader)
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			panic(err)
+		}
+		defer resp.Body.Close()
+		data, _ = ioutil.ReadAll(resp.Body)
+		status = resp.StatusCode
+		return
+	}
+	//auth
+	if status, _ := request("GET", "/admin/certs", "", nil); status != 401 {
+		t.Error("error")
+		return
+	}
+	if status, _ := request("GET", "/admin/certs", certToken, nil); status != 403 {
+		t.Error("error")
+		return
+	}
+	//list
+	status, data := request("GET", "/admin/certs", adminToken, nil)
+	if status != 200 || bytes.Contains(data, []byte(`"123"`)) || !bytes.Contains(data, []byte("a.snows.io")) {
+		t.Error("error")
+		return
+	}
+	//add
+	certB, _ := ca.Issue("b.snows.io")
+	certFileB, keyFileB := writeTestCert(dir, "b", certB)
+	certPEMB, _ := ioutil.ReadFile(certFileB)
+	keyPEMB, _ := ioutil.ReadFile(keyFileB)
+	status, _ = request("POST", "/admin/certs", adminToken, map[string]interface{}{
+		"host": "b.snows.io:443", "cert_pem": string(certPEMB), "key_pem": string(keyPEMB),
+	})
+	if status != 200 || len(persisted) != 2 || persisted[1]["cert"] != filepath.Join(dir, "certs", "b.snows.io_443.crt") {
+		t.Errorf("status:%v,persisted:%v", status, persisted)
+		return
+	}
+	decorder := NewTLSDecorder()
+	decorder.Server = ts.URL + "/cert?host=%v"
+	decorder.Token = certToken
+	cert, err := decorder.certificate("b.snows.io:443")
+	if err != nil || cert.Leaf.SerialNumber.Cmp(certB.Leaf.SerialNumber) != 0 {
+		t.Errorf("err:%v", err)
+		return
+	}
+	if status, _ := request("POST", "/admin/certs", adminToken, map[string]interface{}{
+		"host": "b.snows.io:443", "cert_pem": string(certPEMB), "key_pem": string(keyPEMB),
+	}); status != 409 {
+		t.Error("error")
+		return
+	}
+	//rotate
+	certB2, _ := ca.Issue("b.snows.io")
+	certFileB2, keyFileB2 := writeTestCert(dir, "b2", certB2)
+	certPEMB2, _ := ioutil.ReadFile(certFileB2)
+	keyPEMB2, _ := ioutil.ReadFile(keyFileB2)
+	status, _ = request("PUT", "/admin/certs?host=b.snows.io:443", adminToken, map[string]interface{}{
+		"cert_pem": string(certPEMB2), "key_pem": string(keyPEMB2),
+	})
+	if status != 200 {
+		t.Error("error")
+		return
+	}
+	decorder.certs["b.snows.io:443"].Leaf.NotAfter = time.Now()
+	cert, err = decorder.certificate("b.snows.io:443")
+	if err != nil || cert.Leaf.SerialNumber.Cmp(certB2.Leaf.SerialNumber) != 0 {
+		t.Errorf("err:%v", err)
+		return
+	}
+	//rotate the configured host to cert dir
+	status, _ = request("PUT", "/admin/certs?host=a.snows.io:443", adminToken, map[string]interface{}{
+		"cert_pem": string(certPEM), "key_pem": string(keyPEM),
+	})
+	if status != 200 || persisted[0]["psk"] != "123" || persisted[0]["cert"] != filepath.Join(dir, "certs", "a.snows.io_443.crt") {
+		t.Errorf("status:%v,persisted:%v", status, persisted)
+		return
+	}
+	//persist error
+	persistErr = fmt.Errorf("test error")
+	if status, _ := request("DELETE", "/admin/certs?host=b.snows.io:443", adminToken, nil); status != 500 {
+		t.Error("error")
+		return
+	}
+	if _, err = decorder.certificate("b.snows.io:443"); err != nil {
+		t.Error(err)
+		return
+	}
+	if status, _ := request("PUT", "/admin/certs?host=b.snows.io:443", adminToken, map[string]interface{}{
+		"cert_pem": string(certPEMB), "key_pem": string(keyPEMB),
+	}); status != 500 {
+		t.Error("error")
+		return
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "certs", "b.snows.io_443.crt")); !bytes.Equal(data, certPEMB2) {
+		t.Error("error")
+		return
+	}
+	if status, _ := request("POST", "/admin/certs", adminToken, map[string]interface{}{
+		"host": "c.snows.io:443", "cert_pem": string(certPEMB), "key_pem": string(keyPEMB),
+	}); status != 500 {
+		t.Error("error")
+		return
+	}
+	if _, err := os.Stat(filepath.Join(dir, "certs", "c.snows.io_443.crt")); !os.IsNotExist(err) {
+		t.Error("error")
+		return
+	}
+	persistErr = nil
+	//delete
+	if status, _ := request("DELETE", "/admin/certs?host=b.snows.io:443", adminToken, nil); status != 200 || len(persisted) != 1 {
+		t.Error("error")
+		return
+	}
+	if _, err := os.Stat(filepath.Join(dir, "certs", "b.snows.io_443.crt")); !os.IsNotExist(err) {
+		t.Error("error")
+		return
+	}
+	delete(decorder.certs, "b.snows.io:443")
+	if _, err = decorder.certificate("b.snows.io:443"); err == nil {
+		t.Error("error")
+		return
+	}
+	//error
+	for _, c := range []struct {
+		method, path string
+		body         interface{}
+		status       int
+	}{
+		{"GET", "/admin/xx", nil, 404},
+		{"PATCH", "/admin/certs", nil, 405},
+		{"POST", "/admin/certs", nil, 400},
+		{"POST", "/admin/certs", map[string]interface{}{}, 400},
+		{"POST", "/admin/certs", map[string]interface{}{"host": "c.snows.io:443", "cert_pem": "xx"}, 400},
+		{"PUT", "/admin/certs?host=b.snows.io:443", map[string]interface{}{}, 404},
+		{"PUT", "/admin/certs?host=a.snows.io:443", nil, 400},
+		{"PUT", "/admin/certs?host=a.snows.io:443", map[string]interface{}{"cert_pem": "xx"}, 400},
+		{"DELETE", "/admin/certs?host=b.snows.io:443", nil, 404},
+	} {
+		if status, _ := request(c.method, c.path, adminToken, c.body); status != c.status {
+			t.Errorf("%v %v->%v", c.method, c.path, status)
+			return
+		}
+	}
+	if _, err = parseLeaf(keyPEM); err == nil {
+		t.Error("error")
+		return
+	}
+}
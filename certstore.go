@@ -0,0 +1,424 @@
+package webdebugger
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+//CertStore is the interface to load/save the cert/key of host configure for TLSCertCenter,
+//the host is the configured host of TLSCertCenter, like a.snows.io:443 or *.snows.io
+type CertStore interface {
+	Load(host string) (certPEM, keyPEM []byte, err error)
+	Save(host string, certPEM, keyPEM []byte) (err error)
+	Delete(host string) (err error)
+}
+
+//NewCertStore will create CertStore by configure, supported type is dir/bundle/bolt
+//
+//  dir     {"type":"dir","path":"certs","interval":10}
+//  bundle  {"type":"bundle","path":"certs.bundle","password":"xxx"}
+//  bolt    {"type":"bolt","path":"certs.db"}
+func NewCertStore(config map[string]interface{}) (store CertStore, err error) {
+	storeType, _ := config["type"].(string)
+	path, _ := config["path"].(string)
+	if len(path) < 1 {
+		err = fmt.Errorf("the %v store path is not setted", storeType)
+		return
+	}
+	switch storeType {
+	case "dir":
+		interval := 10 * time.Second
+		if v, ok := config["interval"].(float64); ok {
+			interval = time.Duration(v) * time.Second
+		}
+		store, err = NewDirCertStore(path, interval)
+	case "bundle":
+		password, _ := config["password"].(string)
+		store, err = NewBundleCertStore(path, password)
+	case "bolt":
+		store, err = NewBoltCertStore(path)
+	default:
+		err = fmt.Errorf("the %v store is not supported", storeType)
+	}
+	return
+}
+
+type dirCertEntry struct {
+	cert, key []byte
+	modTime   time.Time
+}
+
+//DirCertStore is CertStore to save cert/key as <host>.crt/<host>.key in directory,
+//the directory is scanned by the watching interval and the changed cert/key is reloaded to cache,
+//so the TLSCertCenter loading from it will serve the changed cert/key with new ETag
+type DirCertStore struct {
+	Dir    string
+	certs  map[string]*dirCertEntry
+	locker sync.RWMutex
+	closed chan int
+}
+
+//NewDirCertStore will create the directory store and start watching by interval, it is not watched when interval is zero
+func NewDirCertStore(dir string, interval time.Duration) (store *DirCertStore, err error) {
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return
+	}
+	store = &DirCertStore{
+		Dir:    dir,
+		certs:  map[string]*dirCertEntry{},
+		locker: sync.RWMutex{},
+		closed: make(chan int),
+	}
+	err = store.Scan()
+	if err == nil && interval > 0 {
+		go store.loopWatch(interval)
+	}
+	return
+}
+
+func (d *DirCertStore) loopWatch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.closed:
+			return
+		case <-ticker.C:
+			if err := d.Scan(); err != nil {
+				WarnLog("DirCertStore scan %v fail with %v", d.Dir, err)
+			}
+		}
+	}
+}
+
+func (d *DirCertStore) files(name string) (certFile, keyFile string) {
+	certFile, keyFile = filepath.Join(d.Dir, name+".crt"), filepath.Join(d.Dir, name+".key")
+	return
+}
+
+//modTime will return the last modify time of cert/key
+func (d *DirCertStore) modTime(name string) (modTime time.Time, err error) {
+	certFile, keyFile := d.files(name)
+	certInfo, err := os.Stat(certFile)
+	if err != nil {
+		return
+	}
+	keyInfo, err := os.Stat(keyFile)
+	if err != nil {
+		return
+	}
+	modTime = certInfo.ModTime()
+	if keyInfo.ModTime().After(modTime) {
+		modTime = keyInfo.ModTime()
+	}
+	return
+}
+
+func (d *DirCertStore) read(name string) (entry *dirCertEntry, err error) {
+	certFile, keyFile := d.files(name)
+	modTime, err := d.modTime(name)
+	if err != nil {
+		return
+	}
+	entry = &dirCertEntry{modTime: modTime}
+	entry.cert, err = ioutil.ReadFile(certFile)
+	if err == nil {
+		entry.key, err = ioutil.ReadFile(keyFile)
+	}
+	return
+}
+
+//Scan will reload all changed cert/key in directory
+func (d *DirCertStore) Scan() (err error) {
+	infos, err := ioutil.ReadDir(d.Dir)
+	if err != nil {
+		return
+	}
+	found := map[string]bool{}
+	changed := []string{}
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".crt") {
+			continue
+		}
+		name := strings.TrimSuffix(info.Name(), ".crt")
+		modTime, xerr := d.modTime(name)
+		if xerr != nil {
+			continue
+		}
+		found[name] = true
+		d.locker.RLock()
+		old := d.certs[name]
+		d.locker.RUnlock()
+		if old != nil && old.modTime.Equal(modTime) {
+			continue
+		}
+		entry, xerr := d.read(name)
+		if xerr != nil {
+			continue
+		}
+		d.locker.Lock()
+		if old == nil || !bytes.Equal(old.cert, entry.cert) || !bytes.Equal(old.key, entry.key) {
+			d.certs[name] = entry
+			changed = append(changed, name)
+		}
+		d.locker.Unlock()
+	}
+	d.locker.Lock()
+	for name := range d.certs {
+		if !found[name] {
+			delete(d.certs, name)
+			changed = append(changed, name)
+		}
+	}
+	d.locker.Unlock()
+	for _, name := range changed {
+		DebugLog("DirCertStore the %v in %v is changed", name, d.Dir)
+	}
+	return
+}
+
+//Load will load the cert/key by host
+func (d *DirCertStore) Load(host string) (certPEM, keyPEM []byte, err error) {
+	name := certFileReplacer.ReplaceAllString(host, "_")
+	d.locker.RLock()
+	entry := d.certs[name]
+	d.locker.RUnlock()
+	if entry == nil {
+		entry, err = d.read(name)
+		if err != nil {
+			err = fmt.Errorf("the %v cert is not found in %v", host, d.Dir)
+			return
+		}
+		d.locker.Lock()
+		d.certs[name] = entry
+		d.locker.Unlock()
+	}
+	certPEM, keyPEM = entry.cert, entry.key
+	return
+}
+
+//Save will save the cert/key by host
+func (d *DirCertStore) Save(host string, certPEM, keyPEM []byte) (err error) {
+	name := certFileReplacer.ReplaceAllString(host, "_")
+	certFile, keyFile := d.files(name)
+	err = writeFileAtomic(certFile, certPEM, 0644)
+	if err == nil {
+		err = writeFileAtomic(keyFile, keyPEM, 0600)
+	}
+	if err == nil {
+		d.locker.Lock()
+		modTime, _ := d.modTime(name)
+		d.certs[name] = &dirCertEntry{cert: certPEM, key: keyPEM, modTime: modTime}
+		d.locker.Unlock()
+	}
+	return
+}
+
+//Delete will delete the cert/key by host
+func (d *DirCertStore) Delete(host string) (err error) {
+	name := certFileReplacer.ReplaceAllString(host, "_")
+	certFile, keyFile := d.files(name)
+	d.locker.Lock()
+	delete(d.certs, name)
+	d.locker.Unlock()
+	os.Remove(keyFile)
+	err = os.Remove(certFile)
+	return
+}
+
+//Close will stop watching
+func (d *DirCertStore) Close() (err error) {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+	select {
+	case <-d.closed:
+	default:
+		close(d.closed)
+	}
+	return
+}
+
+//the bundle file is magic(WDCB1) + salt(16) + nonce(12) + AES-256-GCM sealed json of certs,
+//the AES key is derived by argon2id from password and salt
+var bundleMagic = []byte("WDCB1")
+
+type bundleCert struct {
+	Cert []byte `json:"cert"`
+	Key  []byte `json:"key"`
+}
+
+//BundleCertStore is CertStore to save all cert/key to a single encrypted file by password
+type BundleCertStore struct {
+	File     string
+	Password string
+	certs    map[string]*bundleCert
+	modTime  time.Time
+	locker   sync.RWMutex
+}
+
+//NewBundleCertStore will create the bundle store and load the bundle file when it is exists
+func NewBundleCertStore(file, password string) (store *BundleCertStore, err error) {
+	if len(password) < 1 {
+		err = fmt.Errorf("the bundle password is not setted")
+		return
+	}
+	store = &BundleCertStore{
+		File:     file,
+		Password: password,
+		certs:    map[string]*bundleCert{},
+		locker:   sync.RWMutex{},
+	}
+	store.locker.Lock()
+	err = store.reload()
+	store.locker.Unlock()
+	return
+}
+
+//reload will load the bundle file when it is changed, it must be called in locker
+func (b *BundleCertStore) reload() (err error) {
+	info, err := os.Stat(b.File)
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	}
+	if err != nil || info.ModTime().Equal(b.modTime) {
+		return
+	}
+	data, err := ioutil.ReadFile(b.File)
+	if err != nil {
+		return
+	}
+	if !bytes.HasPrefix(data, bundleMagic) || len(data) < len(bundleMagic)+16 {
+		err = fmt.Errorf("invalid bundle file %v", b.File)
+		return
+	}
+	data = data[len(bundleMagic):]
+	aead, err := bundleAEAD(b.Password, data[:16])
+	if err != nil {
+		return
+	}
+	data = data[16:]
+	if len(data) < aead.NonceSize() {
+		err = fmt.Errorf("invalid bundle file %v", b.File)
+		return
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], bundleMagic)
+	if err != nil {
+		err = fmt.Errorf("decrypt bundle file %v fail with %v", b.File, err)
+		return
+	}
+	certs := map[string]*bundleCert{}
+	err = json.Unmarshal(plain, &certs)
+	if err == nil {
+		b.certs, b.modTime = certs, info.ModTime()
+		DebugLog("BundleCertStore load %v certs from %v", len(certs), b.File)
+	}
+	return
+}
+
+//write will encrypt and write the certs to bundle file, it must be called in locker
+func (b *BundleCertStore) write(certs map[string]*bundleCert) (err error) {
+	plain, err := json.Marshal(certs)
+	if err != nil {
+		return
+	}
+	salt := make([]byte, 16)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return
+	}
+	aead, err := bundleAEAD(b.Password, salt)
+	if err != nil {
+		return
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return
+	}
+	data := append(append(append([]byte{}, bundleMagic...), salt...), nonce...)
+	data = aead.Seal(data, nonce, plain, bundleMagic)
+	err = writeFileAtomic(b.File, data, 0600)
+	if err != nil {
+		return
+	}
+	b.certs = certs
+	if info, xerr := os.Stat(b.File); xerr == nil {
+		b.modTime = info.ModTime()
+	}
+	return
+}
+
+func bundleAEAD(password string, salt []byte) (aead cipher.AEAD, err error) {
+	block, err := aes.NewCipher(argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, 32))
+	if err != nil {
+		return
+	}
+	aead, err = cipher.NewGCM(block)
+	return
+}
+
+//Load will load the cert/key by host, the bundle file is reloaded when it is changed
+func (b *BundleCertStore) Load(host string) (certPEM, keyPEM []byte, err error) {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+	err = b.reload()
+	if err != nil {
+		return
+	}
+	cert := b.certs[host]
+	if cert == nil {
+		err = fmt.Errorf("the %v cert is not found in %v", host, b.File)
+		return
+	}
+	certPEM, keyPEM = cert.Cert, cert.Key
+	return
+}
+
+//Save will save the cert/key by host
+func (b *BundleCertStore) Save(host string, certPEM, keyPEM []byte) (err error) {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+	err = b.reload()
+	if err != nil {
+		return
+	}
+	certs := map[string]*bundleCert{}
+	for k, v := range b.certs {
+		certs[k] = v
+	}
+	certs[host] = &bundleCert{Cert: certPEM, Key: keyPEM}
+	err = b.write(certs)
+	return
+}
+
+//Delete will delete the cert/key by host
+func (b *BundleCertStore) Delete(host string) (err error) {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+	err = b.reload()
+	if err != nil {
+		return
+	}
+	certs := map[string]*bundleCert{}
+	for k, v := range b.certs {
+		if k != host {
+			certs[k] = v
+		}
+	}
+	err = b.write(certs)
+	return
+}
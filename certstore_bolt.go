@@ -0,0 +1,78 @@
+package webdebugger
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltCertBucket = []byte("certs")
+
+//BoltCertStore is CertStore to save cert/key in BoltDB
+type BoltCertStore struct {
+	DB *bolt.DB
+}
+
+//NewBoltCertStore will open the BoltDB file and create the certs bucket when it is not exists
+func NewBoltCertStore(file string) (store *BoltCertStore, err error) {
+	db, err := bolt.Open(file, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	if err != nil {
+		return
+	}
+	err = db.Update(func(tx *bolt.Tx) (xerr error) {
+		_, xerr = tx.CreateBucketIfNotExists(boltCertBucket)
+		return
+	})
+	if err != nil {
+		db.Close()
+		return
+	}
+	store = &BoltCertStore{DB: db}
+	return
+}
+
+//Load will load the cert/key by host
+func (b *BoltCertStore) Load(host string) (certPEM, keyPEM []byte, err error) {
+	cert := &bundleCert{}
+	err = b.DB.View(func(tx *bolt.Tx) (xerr error) {
+		data := tx.Bucket(boltCertBucket).Get([]byte(host))
+		if data == nil {
+			xerr = fmt.Errorf("the %v cert is not found in %v", host, b.DB.Path())
+			return
+		}
+		xerr = json.Unmarshal(data, cert)
+		return
+	})
+	if err == nil {
+		certPEM, keyPEM = cert.Cert, cert.Key
+	}
+	return
+}
+
+//Save will save the cert/key by host
+func (b *BoltCertStore) Save(host string, certPEM, keyPEM []byte) (err error) {
+	data, err := json.Marshal(&bundleCert{Cert: certPEM, Key: keyPEM})
+	if err != nil {
+		return
+	}
+	err = b.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltCertBucket).Put([]byte(host), data)
+	})
+	return
+}
+
+//Delete will delete the cert/key by host
+func (b *BoltCertStore) Delete(host string) (err error) {
+	err = b.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltCertBucket).Delete([]byte(host))
+	})
+	return
+}
+
+//Close will close the BoltDB
+func (b *BoltCertStore) Close() (err error) {
+	err = b.DB.Close()
+	return
+}
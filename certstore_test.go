@@ -0,0 +1,325 @@
+package webdebugger
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testCertStore(t *testing.T, store CertStore) {
+	err := store.Save("a.snows.io:443", []byte("cert1"), []byte("key1"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = store.Save("*.snows.io", []byte("cert2"), []byte("key2"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	cert, key, err := store.Load("a.snows.io:443")
+	if err != nil || string(cert) != "cert1" || string(key) != "key1" {
+		t.Errorf("err:%v", err)
+		return
+	}
+	cert, key, err = store.Load("*.snows.io")
+	if err != nil || string(cert) != "cert2" || string(key) != "key2" {
+		t.Errorf("err:%v", err)
+		return
+	}
+	err = store.Save("a.snows.io:443", []byte("cert3"), []byte("key3"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	cert, key, err = store.Load("a.snows.io:443")
+	if err != nil || string(cert) != "cert3" || string(key) != "key3" {
+		t.Errorf("err:%v", err)
+		return
+	}
+	err = store.Delete("a.snows.io:443")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, _, err = store.Load("a.snows.io:443")
+	if err == nil {
+		t.Error("error")
+		return
+	}
+	_, _, err = store.Load("b.snows.io:443")
+	if err == nil {
+		t.Error("error")
+		return
+	}
+}
+
+func TestDirCertStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wdebugger")
+	defer os.RemoveAll(dir)
+	store, err := NewDirCertStore(dir, 50*time.Millisecond)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer store.Close()
+	testCertStore(t, store)
+	//watch
+	waitCert := func(expect string) (cert []byte, err error) {
+		for i := 0; i < 100; i++ {
+			cert, _, err = store.Load("b.snows.io:443")
+			if string(cert) == expect {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return
+	}
+	ioutil.WriteFile(filepath.Join(dir, "b.snows.io_443.crt"), []byte("cert4"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "b.snows.io_443.key"), []byte("key4"), 0600)
+	cert, err := waitCert("cert4")
+	if err != nil || string(cert) != "cert4" {
+		t.Errorf("err:%v", err)
+		return
+	}
+	time.Sleep(10 * time.Millisecond)
+	ioutil.WriteFile(filepath.Join(dir, "b.snows.io_443.crt"), []byte("cert5"), 0644)
+	os.Chtimes(filepath.Join(dir, "b.snows.io_443.crt"), time.Now(), time.Now().Add(time.Second))
+	cert, _ = waitCert("cert5")
+	if string(cert) != "cert5" {
+		t.Errorf("cert:%v", string(cert))
+		return
+	}
+	os.Remove(filepath.Join(dir, "b.snows.io_443.crt"))
+	if _, err = waitCert(""); err == nil {
+		t.Error("error")
+		return
+	}
+	store.Close()
+	//error
+	ioutil.WriteFile(filepath.Join(dir, "file"), nil, 0644)
+	if _, err = NewDirCertStore(filepath.Join(dir, "file"), 0); err == nil {
+		t.Error("error")
+		return
+	}
+}
+
+func TestBundleCertStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wdebugger")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "certs.bundle")
+	store, err := NewBundleCertStore(file, "123")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	testCertStore(t, store)
+	data, _ := ioutil.ReadFile(file)
+	if bytes.Contains(data, []byte("cert2")) || bytes.Contains(data, []byte("key2")) {
+		t.Error("not encrypted")
+		return
+	}
+	//reload by other
+	other, err := NewBundleCertStore(file, "123")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if cert, _, err := other.Load("*.snows.io"); err != nil || string(cert) != "cert2" {
+		t.Errorf("err:%v", err)
+		return
+	}
+	time.Sleep(10 * time.Millisecond)
+	other.Save("b.snows.io:443", []byte("cert4"), []byte("key4"))
+	os.Chtimes(file, time.Now(), time.Now().Add(time.Second))
+	if cert, _, err := store.Load("b.snows.io:443"); err != nil || string(cert) != "cert4" {
+		t.Errorf("err:%v", err)
+		return
+	}
+	//error
+	if _, err = NewBundleCertStore(file, "1234"); err == nil {
+		t.Error("error")
+		return
+	}
+	if _, err = NewBundleCertStore(file, ""); err == nil {
+		t.Error("error")
+		return
+	}
+	ioutil.WriteFile(file, []byte("WDCB1xx"), 0600)
+	if _, err = NewBundleCertStore(file, "123"); err == nil {
+		t.Error("error")
+		return
+	}
+	ioutil.WriteFile(file, append([]byte("WDCB1"), make([]byte, 20)...), 0600)
+	if _, err = NewBundleCertStore(file, "123"); err == nil {
+		t.Error("error")
+		return
+	}
+	os.Chtimes(file, time.Now(), time.Now().Add(2*time.Second))
+	if _, _, err = store.Load("*.snows.io"); err == nil {
+		t.Error("error")
+		return
+	}
+	if err = store.Save("*.snows.io", nil, nil); err == nil {
+		t.Error("error")
+		return
+	}
+	if err = store.Delete("*.snows.io"); err == nil {
+		t.Error("error")
+		return
+	}
+}
+
+func TestBoltCertStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wdebugger")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "certs.db")
+	store, err := NewBoltCertStore(file)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	testCertStore(t, store)
+	store.Close()
+	store, err = NewBoltCertStore(file)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer store.Close()
+	if cert, _, err := store.Load("*.snows.io"); err != nil || string(cert) != "cert2" {
+		t.Errorf("err:%v", err)
+		return
+	}
+	//error
+	if _, err = NewBoltCertStore(filepath.Join(dir, "xx", "certs.db")); err == nil {
+		t.Error("error")
+		return
+	}
+}
+
+func TestNewCertStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wdebugger")
+	defer os.RemoveAll(dir)
+	for _, config := range []map[string]interface{}{
+		{"type": "dir", "path": filepath.Join(dir, "certs"), "interval": float64(0)},
+		{"type": "bundle", "path": filepath.Join(dir, "certs.bundle"), "password": "123"},
+		{"type": "bolt", "path": filepath.Join(dir, "certs.db")},
+	} {
+		store, err := NewCertStore(config)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if closer, ok := store.(interface{ Close() error }); ok {
+			closer.Close()
+		}
+	}
+	for _, config := range []map[string]interface{}{
+		{"type": "dir"},
+		{"type": "xx", "path": "xx"},
+	} {
+		if _, err := NewCertStore(config); err == nil {
+			t.Error("error")
+			return
+		}
+	}
+}
+
+func TestTLSCertCenterStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wdebugger")
+	defer os.RemoveAll(dir)
+	ca, _ := GenerateCA("test")
+	certA, _ := ca.Issue("a.snows.io")
+	certFileA, keyFileA := writeTestCert(dir, "a", certA)
+	certPEM, _ := ioutil.ReadFile(certFileA)
+	keyPEM, _ := ioutil.ReadFile(keyFileA)
+	store, _ := NewBundleCertStore(filepath.Join(dir, "certs.bundle"), "123")
+	store.Save("*.snows.io:443", certPEM, keyPEM)
+	center := NewTLSCertCenter(map[string]interface{}{"host": "*.snows.io:443"})
+	center.Store = store
+	adminToken, _ := NewToken()
+	adminHash := HashToken(adminToken)
+	center.Tokens = []*AuthToken{{Name: "admin", Token: adminHash, Scopes: []string{"admin"}}}
+	var persisted []map[string]interface{}
+	var persistErr error
+	center.Persist = func(certs []map[string]interface{}) error {
+		if persistErr == nil {
+			persisted = certs
+		}
+		return persistErr
+	}
+	ts := httptest.NewServer(center)
+	defer ts.Close()
+	decorder := NewTLSDecorder()
+	decorder.Server = ts.URL + "/cert?host=%v"
+	cert, err := decorder.certificate("a.snows.io:443")
+	if err != nil || cert.Leaf.SerialNumber.Cmp(certA.Leaf.SerialNumber) != 0 {
+		t.Errorf("err:%v", err)
+		return
+	}
+	//admin
+	certB, _ := ca.Issue("b.xx.io")
+	certFileB, keyFileB := writeTestCert(dir, "b", certB)
+	certPEMB, _ := ioutil.ReadFile(certFileB)
+	keyPEMB, _ := ioutil.ReadFile(keyFileB)
+	body := bytes.NewBufferString(`{"host":"b.xx.io:443","cert_pem":` + jsonString(certPEMB) + `,"key_pem":` + jsonString(keyPEMB) + `}`)
+	req, _ := http.NewRequest("POST", ts.URL+"/admin/certs", body)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != 200 || len(persisted) != 2 || persisted[1]["cert"] != nil {
+		t.Errorf("err:%v,persisted:%v", err, persisted)
+		return
+	}
+	if saved, _, _ := store.Load("b.xx.io:443"); !bytes.Equal(saved, certPEMB) {
+		t.Error("error")
+		return
+	}
+	cert, err = decorder.certificate("b.xx.io:443")
+	if err != nil || cert.Leaf.SerialNumber.Cmp(certB.Leaf.SerialNumber) != 0 {
+		t.Errorf("err:%v", err)
+		return
+	}
+	req, _ = http.NewRequest("DELETE", ts.URL+"/admin/certs?host=b.xx.io:443", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != 200 {
+		t.Errorf("err:%v", err)
+		return
+	}
+	if _, _, err = store.Load("b.xx.io:443"); err == nil {
+		t.Error("error")
+		return
+	}
+	//restore on persist error
+	persistErr = fmt.Errorf("test error")
+	body = bytes.NewBufferString(`{"cert_pem":` + jsonString(certPEMB) + `,"key_pem":` + jsonString(keyPEMB) + `}`)
+	req, _ = http.NewRequest("PUT", ts.URL+"/admin/certs?host=*.snows.io:443", body)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != 500 {
+		t.Errorf("err:%v", err)
+		return
+	}
+	if saved, _, _ := store.Load("*.snows.io:443"); !bytes.Equal(saved, certPEM) {
+		t.Error("error")
+		return
+	}
+	persistErr = nil
+	//not cert/key
+	center.Store = nil
+	if _, err = decorder.certificate("c.snows.io:443"); err == nil {
+		t.Error("error")
+		return
+	}
+}
+
+func jsonString(data []byte) string {
+	return `"` + string(bytes.Replace(data, []byte("\n"), []byte(`\n`), -1)) + `"`
+}
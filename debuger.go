@@ -1,13 +1,15 @@
 package webdebugger
 
 import (
-	"bytes"
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strings"
 	"sync"
 )
 
@@ -15,15 +17,21 @@ import (
 type Config struct {
 	Hosts    []*ConfigHost            `json:"hosts"`
 	Decorder []map[string]interface{} `json:"decorder"`
+	Capture  *CaptureConfig           `json:"capture"`
 }
 
-//ConfigHost is pojo to debuger configure
+//ConfigHost is pojo to debuger configure, the Host/IP can be exact host:port, host without port,
+//wildcard like *.snows.io:443, CIDR like 10.0.0.0/8 or regexp started with ~, see rank* for the precedence
 type ConfigHost struct {
-	Host        string `json:"host"`
-	IP          string `json:"ip"`
-	Decorder    string `json:"decorder"`
-	Forward     string `json:"forward"`
-	DumpRequest int    `json:"dump_request"`
+	Host         string        `json:"host"`
+	IP           string        `json:"ip"`
+	Decorder     string        `json:"decorder"`
+	Forward      string        `json:"forward"`
+	DumpRequest  int           `json:"dump_request"`
+	DumpResponse int           `json:"dump_response"`
+	DumpBody     int           `json:"dump_body"`  //the level to dump body of request/response, see DumpBody*
+	DumpLimit    int           `json:"dump_limit"` //the max bytes of body to dump, default is DefaultDumpLimit
+	Breakpoints  []*Breakpoint `json:"breakpoints"`
 }
 
 type remoteAddrConn struct {
@@ -43,6 +51,21 @@ func (r *remoteAddrConn) String() string {
 	return r.Remote
 }
 
+type connContextKey struct{}
+
+//connectionState will return the tls connection state of decorded connection in request context
+func connectionState(r *http.Request) (state *tls.ConnectionState) {
+	conn, _ := r.Context().Value(connContextKey{}).(*remoteAddrConn)
+	if conn == nil {
+		return
+	}
+	if tlsConn, ok := conn.Conn.(interface{ ConnectionState() tls.ConnectionState }); ok {
+		s := tlsConn.ConnectionState()
+		state = &s
+	}
+	return
+}
+
 //Debuger provider the web debuger suppported
 type Debuger struct {
 	*Config
@@ -50,7 +73,12 @@ type Debuger struct {
 	closed    bool
 	connQueue chan net.Conn
 	server    *http.Server
+	decorders map[string]Decorder
 	Decorder  DecorderCreator
+	Capture   *CaptureStore
+	holds     map[uint64]*BreakpointHold
+	holdID    uint64
+	holdsLck  sync.RWMutex
 }
 
 //NewDebuger will return new Debuger
@@ -60,14 +88,25 @@ func NewDebuger(config *Config) (debuger *Debuger) {
 		configLck: sync.RWMutex{},
 		closed:    false,
 		connQueue: make(chan net.Conn, 1000),
+		decorders: map[string]Decorder{},
 		Decorder:  DefaultDecorderCreator,
+		holds:     map[uint64]*BreakpointHold{},
+		holdsLck:  sync.RWMutex{},
+	}
+	if config.Capture != nil {
+		debuger.Capture = NewCaptureStore(config.Capture)
 	}
 	return
 }
 
 //Serve will start the http proxy server
 func (d *Debuger) Serve() (err error) {
-	d.server = &http.Server{Handler: d}
+	d.server = &http.Server{
+		Handler: d,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			return context.WithValue(ctx, connContextKey{}, conn)
+		},
+	}
 	err = d.server.Serve(d)
 	return
 }
@@ -75,99 +114,153 @@ func (d *Debuger) Serve() (err error) {
 //ProcConn will proc raw connection to uri
 func (d *Debuger) ProcConn(uri string, raw net.Conn) (async bool, err error) {
 	if d.closed {
-		err = fmt.Errorf("Debuger is closed")
+		err = &ReplyError{Err: fmt.Errorf("Debuger is closed"), Rep: 0x02}
 		return
 	}
-	var host *ConfigHost
-	for _, h := range d.Hosts {
-		if h.Host == uri || h.IP == uri {
-			host = h
-			break
-		}
-	}
+	host := matchHost(d.Hosts, uri)
 	if host == nil { //direct
 		DebugLog("Debuger start proc %v to %v by direct", raw, uri)
 		var conn net.Conn
 		conn, err = net.Dial("tcp", uri)
 		if err == nil {
+			if bound, ok := raw.(interface{ SetBound(addr net.Addr) }); ok {
+				bound.SetBound(conn.LocalAddr())
+			}
 			go io.Copy(conn, raw)
 			_, err = io.Copy(raw, conn)
 		}
 		return
 	}
 	InfoLog("Debuger start proc %v to %v by forwarding to %v", raw, uri, host.Forward)
+	decorder, err := d.loadDecorder(host.Decorder)
+	if err != nil {
+		err = &ReplyError{Err: err, Rep: 0x02}
+		return
+	}
+	conn, err := decorder.Decord(host.decordHost(uri), raw)
+	if err != nil {
+		return
+	}
+	d.connQueue <- &remoteAddrConn{Conn: conn, Remote: uri}
+	async = true
+	return
+}
+
+//loadDecorder will return the cached decorder by name or create it by configure
+func (d *Debuger) loadDecorder(name string) (decorder Decorder, err error) {
 	d.configLck.RLock()
+	decorder = d.decorders[name]
+	d.configLck.RUnlock()
+	if decorder != nil {
+		return
+	}
+	d.configLck.Lock()
+	defer d.configLck.Unlock()
+	if decorder = d.decorders[name]; decorder != nil {
+		return
+	}
 	var decorderConfig map[string]interface{}
 	for _, c := range d.Config.Decorder {
-		if n, _ := c["name"].(string); n == host.Decorder {
+		if n, _ := c["name"].(string); n == name {
 			decorderConfig = c
 			break
 		}
 	}
-	d.configLck.RUnlock()
-	decorder, err := d.Decorder(host.Decorder, decorderConfig)
-	if err != nil {
+	decorder, err = d.Decorder(name, decorderConfig)
+	if err == nil {
+		d.decorders[name] = decorder
+	}
+	return
+}
+
+//ProcUDP will return the target address to forward udp packet for uri,
+//the configured host with udp://host:port forward will be forwarded to that address, others is direct
+func (d *Debuger) ProcUDP(uri string) (target string, err error) {
+	if d.closed {
+		err = &ReplyError{Err: fmt.Errorf("Debuger is closed"), Rep: 0x02}
 		return
 	}
-	conn, err := decorder.Decord(host.Host, raw)
-	if err != nil {
+	target = uri
+	host := matchHost(d.Hosts, uri)
+	if host == nil {
+		DebugLog("Debuger start proc udp to %v by direct", uri)
 		return
 	}
-	d.connQueue <- &remoteAddrConn{Conn: conn, Remote: uri}
-	async = true
+	if strings.HasPrefix(host.Forward, "udp://") {
+		target = strings.TrimPrefix(host.Forward, "udp://")
+	}
+	InfoLog("Debuger start proc udp to %v by forwarding to %v", uri, target)
 	return
 }
 
 func (d *Debuger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	var host *ConfigHost
-	for _, h := range d.Hosts {
-		if h.Host == r.RemoteAddr || h.IP == r.RemoteAddr {
-			host = h
-			break
-		}
-	}
+	host := matchHost(d.Hosts, r.RemoteAddr)
 	if host == nil {
 		w.WriteHeader(404)
 		fmt.Fprintf(w, "%v is not configured", r.Host)
 		return
 	}
+	d.forward(w, r, host)
+}
+
+//forward will forward the request to Forward of host, the exchange is dumped and captured by configure,
+//it return the captured exchange when capture is enabled
+func (d *Debuger) forward(w http.ResponseWriter, r *http.Request, host *ConfigHost) (entry *CaptureEntry) {
 	target, err := url.Parse(host.Forward)
 	if err != nil {
 		w.WriteHeader(500)
 		fmt.Fprintf(w, "parse %v fail with %v", host.Forward, err)
 		return
 	}
-	if host.DumpRequest > 0 {
-		buf := bytes.NewBuffer(nil)
-		//
-		fmt.Fprintln(buf, "---URL---")
-		fmt.Fprintln(buf, "Host\t", r.Host)
-		fmt.Fprintln(buf, "Path\t", r.URL.Path)
-		fmt.Fprintln(buf, "RawPath\t", r.URL.RawPath)
-		fmt.Fprintln(buf, "RawQuery\t", r.URL.RawQuery)
-		fmt.Fprintln(buf, "User\t", r.URL.User)
-		//
-		fmt.Fprintln(buf, "\n---Header---")
-		for k, v := range r.Header {
-			fmt.Fprintln(buf, k, "\t", v)
-		}
-		//
-		fmt.Fprintln(buf, "\n---Form---")
-		for k, v := range r.Form {
-			fmt.Fprintln(buf, k, "\t", v)
-		}
-		//
-		fmt.Fprintln(buf, "---PostForm---")
-		for k, v := range r.PostForm {
-			fmt.Fprintln(buf, k, "\t", v)
-		}
-		fmt.Fprintf(buf, "\n\n\n")
-		InfoLog("Debuger dump request:\n%v", string(buf.Bytes()))
+	if breakpoint := host.breakpoint(BreakRequest, r); breakpoint != nil && !d.holdRequest(w, r, breakpoint) {
+		return
+	}
+	var capture *captureExchange
+	if d.Capture != nil {
+		capture = d.Capture.begin(host, r, connectionState(r))
+		entry = capture.entry
+		w = &captureWriter{ResponseWriter: w, exchange: capture, limit: d.Capture.MaxBody}
 	}
+	origin := r.Host
 	r.Host = target.Host
 	r.Header.Add("WebDebuggerProxy", "v1.0.0")
 	proxy := httputil.NewSingleHostReverseProxy(target)
+	if host.DumpRequest > 0 || host.DumpResponse > 0 {
+		dumper := &httpDumper{Host: host, Origin: origin, Transport: http.DefaultTransport}
+		proxy.Transport = dumper
+		proxy.ModifyResponse = dumper.ModifyResponse
+	}
+	if breakpoint := host.breakpoint(BreakResponse, r); breakpoint != nil {
+		originURL := requestScheme(r, connectionState(r)) + "://" + origin
+		modify := proxy.ModifyResponse
+		proxy.ModifyResponse = func(resp *http.Response) (err error) {
+			err = d.holdResponse(resp, breakpoint, originURL)
+			if err == nil && modify != nil {
+				err = modify(resp)
+			}
+			return
+		}
+	}
+	if capture != nil {
+		modify := proxy.ModifyResponse
+		proxy.ModifyResponse = func(resp *http.Response) (err error) {
+			capture.proto = resp.Proto
+			if modify != nil {
+				err = modify(resp)
+			}
+			return
+		}
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			WarnLog("Debuger proxy %v to %v fail with %v", r.URL, host.Forward, err)
+			capture.err = err
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}
 	proxy.ServeHTTP(w, r)
+	if capture != nil {
+		d.Capture.finish(capture)
+	}
+	return
 }
 
 //Accept will accept on conn from queue
@@ -187,6 +280,13 @@ func (d *Debuger) Close() (err error) {
 		d.closed = true
 		d.server.Close()
 		close(d.connQueue)
+		d.configLck.Lock()
+		for _, decorder := range d.decorders {
+			if closer, ok := decorder.(io.Closer); ok {
+				closer.Close()
+			}
+		}
+		d.configLck.Unlock()
 	}
 	return
 }
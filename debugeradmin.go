@@ -0,0 +1,357 @@
+package webdebugger
+
+import (
+	"crypto/subtle"
+	_ "embed" //for web ui
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+//go:embed webui/index.html
+var webUIIndex []byte
+
+//CaptureSummary is pojo to the summary of captured exchange for listing
+type CaptureSummary struct {
+	ID       uint64    `json:"id"`
+	Started  time.Time `json:"started"`
+	Method   string    `json:"method"`
+	URL      string    `json:"url"`
+	Host     string    `json:"host"`
+	Status   int       `json:"status"`
+	Size     int64     `json:"size"`
+	Time     float64   `json:"time"`
+	Error    string    `json:"error,omitempty"`
+	ReplayOf uint64    `json:"replay_of,omitempty"`
+}
+
+//Summary will return the summary of exchange
+func (c *CaptureEntry) Summary() (summary *CaptureSummary) {
+	summary = &CaptureSummary{
+		ID:       c.ID,
+		Started:  c.Started,
+		Method:   c.Request.Method,
+		URL:      c.Request.URL,
+		Status:   c.Response.Status,
+		Size:     c.Response.BodySize,
+		Time:     harMillis(c.Timings.Total()),
+		Error:    c.Error,
+		ReplayOf: c.ReplayOf,
+	}
+	if u, err := url.Parse(c.Request.URL); err == nil {
+		summary.Host = u.Host
+	}
+	return
+}
+
+//CaptureFilter is the filter to captured exchange
+//
+//  Host   the host contains it
+//  Status the exact status like 200, or status class like 4xx
+//  Method the request method in case-insensitive
+type CaptureFilter struct {
+	Host   string
+	Status string
+	Method string
+}
+
+//Match will check the exchange is matched by filter
+func (c *CaptureFilter) Match(summary *CaptureSummary) bool {
+	if len(c.Host) > 0 && !strings.Contains(summary.Host, c.Host) {
+		return false
+	}
+	if len(c.Method) > 0 && !strings.EqualFold(summary.Method, c.Method) {
+		return false
+	}
+	if len(c.Status) > 0 {
+		status := fmt.Sprintf("%d", summary.Status)
+		if strings.HasSuffix(strings.ToLower(c.Status), "xx") {
+			return len(status) == 3 && status[0] == c.Status[0]
+		}
+		return status == c.Status
+	}
+	return true
+}
+
+//DebugerAdmin provider the web ui and admin api to browse exchange captured by Debuger
+//
+//  GET    /                       the web ui
+//  GET    /api/captures           list exchange summary by filter host/status/method
+//  DELETE /api/captures           clear exchange in memory
+//  GET    /api/captures/<id>      get exchange as HAR entry
+//  GET    /api/har?id=1&id=2      export exchange as HAR file, all exchange in memory is exported when id is not setted
+//  GET    /api/live               websocket to receive new exchange summary by filter
+//  POST   /api/replay?id=1        replay exchange with ReplayOptions json body, it return {"original":HAREntry,"replay":HAREntry}
+//  GET    /api/holds              list request/response which is held by breakpoint
+//  POST   /api/holds/<id>         resume the held request/response with BreakpointEdit json body
+//
+//the request is authorized by basic auth when Username is setted, the Password is hashed by HashPassword.
+//the captured exchange contains the cookie and credential of client, so it should be listened on loopback without Username.
+//the DELETE/POST request is refused when it is sent from other origin, and the POST body must be application/json.
+//the request Host must be localhost, 127.0.0.1, [::1] or the host in Hosts to refuse DNS rebinding,
+//any ip is allowed when the host in Hosts is unspecified like 0.0.0.0.
+//the capture api is not found when the Debuger capture is not configured.
+type DebugerAdmin struct {
+	Debuger  *Debuger
+	Username string
+	Password string
+	Hosts    []string //the allowed host of request, it is the listen address normally
+	live     *websocket.Server
+}
+
+//NewDebugerAdmin will create new DebugerAdmin
+func NewDebugerAdmin(debuger *Debuger) (admin *DebugerAdmin) {
+	admin = &DebugerAdmin{Debuger: debuger}
+	admin.live = &websocket.Server{Handshake: checkSameOrigin, Handler: admin.procLive}
+	return
+}
+
+func (d *DebugerAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !d.allowHost(r.Host) {
+		WarnLog("DebugerAdmin the request to host %v from %v is denied", r.Host, r.RemoteAddr)
+		w.WriteHeader(403)
+		w.Write([]byte("Host Not Allowed.\n"))
+		return
+	}
+	if len(d.Username) > 0 {
+		username, password, ok := r.BasicAuth()
+		userMatched := subtle.ConstantTimeCompare([]byte(username), []byte(d.Username)) == 1
+		if !ok || !VerifyPassword(d.Password, password) || !userMatched {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Web Debugger"`)
+			w.WriteHeader(401)
+			w.Write([]byte("Unauthorized.\n"))
+			return
+		}
+	}
+	path := r.URL.Path
+	if d.Debuger.Capture == nil && strings.HasPrefix(path, "/api/") && !strings.HasPrefix(path, "/api/holds") {
+		w.WriteHeader(404)
+		fmt.Fprintf(w, "capture is not configured")
+		return
+	}
+	switch {
+	case path == "/" || path == "/index.html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(webUIIndex)
+	case path == "/api/captures" && r.Method == "GET":
+		d.listCaptures(w, r)
+	case path == "/api/captures" && r.Method == "DELETE":
+		if allowChange(w, r, false) {
+			d.Debuger.Capture.Clear()
+			writeJSON(w, 200, map[string]interface{}{"code": 0})
+		}
+	case strings.HasPrefix(path, "/api/captures/") && r.Method == "GET":
+		d.getCapture(w, r)
+	case path == "/api/har":
+		d.exportHAR(w, r)
+	case path == "/api/replay" && r.Method == "POST":
+		d.replay(w, r)
+	case path == "/api/holds" && r.Method == "GET":
+		writeJSON(w, 200, d.Debuger.Holds())
+	case strings.HasPrefix(path, "/api/holds/") && r.Method == "POST":
+		d.resume(w, r)
+	case path == "/api/live":
+		d.live.ServeHTTP(w, r)
+	default:
+		w.WriteHeader(404)
+		fmt.Fprintf(w, "%v %v is not supported", r.Method, path)
+	}
+}
+
+//allowHost will check the request host is loopback or in Hosts
+func (d *DebugerAdmin) allowHost(host string) bool {
+	name, _ := splitHostPort(host)
+	name = strings.ToLower(name)
+	if name == "localhost" || name == "127.0.0.1" || name == "::1" {
+		return true
+	}
+	for _, allowed := range d.Hosts {
+		allowedName, _ := splitHostPort(allowed)
+		if ip := net.ParseIP(allowedName); len(allowedName) < 1 || ip != nil && ip.IsUnspecified() {
+			if net.ParseIP(name) != nil {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(allowedName, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func captureFilter(r *http.Request) (filter *CaptureFilter) {
+	query := r.URL.Query()
+	filter = &CaptureFilter{
+		Host:   query.Get("host"),
+		Status: query.Get("status"),
+		Method: query.Get("method"),
+	}
+	return
+}
+
+func (d *DebugerAdmin) listCaptures(w http.ResponseWriter, r *http.Request) {
+	filter := captureFilter(r)
+	summaries := []*CaptureSummary{}
+	for _, entry := range d.Debuger.Capture.List() {
+		if summary := entry.Summary(); filter.Match(summary) {
+			summaries = append(summaries, summary)
+		}
+	}
+	writeJSON(w, 200, summaries)
+}
+
+func (d *DebugerAdmin) getCapture(w http.ResponseWriter, r *http.Request) {
+	entry, err := d.findCapture(strings.TrimPrefix(r.URL.Path, "/api/captures/"))
+	if err != nil {
+		w.WriteHeader(404)
+		fmt.Fprintf(w, "%v", err)
+		return
+	}
+	writeJSON(w, 200, entry.HAR())
+}
+
+func (d *DebugerAdmin) findCapture(id string) (entry *CaptureEntry, err error) {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err == nil {
+		entry, err = d.Debuger.Capture.Find(n)
+	}
+	return
+}
+
+func (d *DebugerAdmin) exportHAR(w http.ResponseWriter, r *http.Request) {
+	ids := r.URL.Query()["id"]
+	entries := []*CaptureEntry{}
+	if len(ids) < 1 {
+		entries = d.Debuger.Capture.List()
+	}
+	for _, id := range ids {
+		entry, err := d.findCapture(id)
+		if err != nil {
+			w.WriteHeader(404)
+			fmt.Fprintf(w, "%v", err)
+			return
+		}
+		entries = append(entries, entry)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="wdebugger-%v.har"`, time.Now().Format("20060102150405")))
+	WriteHAR(w, entries)
+}
+
+func (d *DebugerAdmin) replay(w http.ResponseWriter, r *http.Request) {
+	if !allowChange(w, r, true) {
+		return
+	}
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "invalid id %v", r.URL.Query().Get("id"))
+		return
+	}
+	options := &ReplayOptions{}
+	if r.ContentLength != 0 {
+		err = json.NewDecoder(r.Body).Decode(options)
+		if err != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "parse body fail with %v", err)
+			return
+		}
+	}
+	original, replay, err := d.Debuger.Replay(id, options)
+	if err != nil {
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "replay fail with %v", err)
+		return
+	}
+	writeJSON(w, 200, map[string]interface{}{"original": original.HAR(), "replay": replay.HAR()})
+}
+
+func (d *DebugerAdmin) resume(w http.ResponseWriter, r *http.Request) {
+	if !allowChange(w, r, true) {
+		return
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/api/holds/"), 10, 64)
+	if err != nil {
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "invalid id %v", strings.TrimPrefix(r.URL.Path, "/api/holds/"))
+		return
+	}
+	edit := &BreakpointEdit{}
+	if r.ContentLength != 0 {
+		err = json.NewDecoder(r.Body).Decode(edit)
+		if err != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "parse body fail with %v", err)
+			return
+		}
+	}
+	err = d.Debuger.Resume(id, edit)
+	if err != nil {
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "resume fail with %v", err)
+		return
+	}
+	writeJSON(w, 200, map[string]interface{}{"id": id})
+}
+
+//allowChange will check the state changing request is sent from same origin and with json body when body is true,
+//so other site can't change the state by cross-site form post
+func allowChange(w http.ResponseWriter, r *http.Request, body bool) bool {
+	if origin := r.Header.Get("Origin"); len(origin) > 0 {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			w.WriteHeader(403)
+			fmt.Fprintf(w, "origin %v is not allowed", origin)
+			return false
+		}
+	}
+	if body {
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			w.WriteHeader(415)
+			fmt.Fprintf(w, "Content-Type application/json is required")
+			return false
+		}
+	}
+	return true
+}
+
+//checkSameOrigin will check the websocket origin is same to admin host, so other site can't read the captured exchange
+func checkSameOrigin(config *websocket.Config, r *http.Request) (err error) {
+	config.Origin, err = websocket.Origin(config, r)
+	if err == nil && (config.Origin == nil || config.Origin.Host != r.Host) {
+		err = fmt.Errorf("origin %v is not allowed", r.Header.Get("Origin"))
+	}
+	return
+}
+
+func (d *DebugerAdmin) procLive(ws *websocket.Conn) {
+	filter := captureFilter(ws.Request())
+	entries, cancel := d.Debuger.Capture.Subscribe()
+	defer cancel()
+	go func() {
+		//wait the client closed
+		var message string
+		for websocket.Message.Receive(ws, &message) == nil {
+		}
+		cancel()
+	}()
+	DebugLog("DebugerAdmin live is started from %v", ws.Request().RemoteAddr)
+	for entry := range entries {
+		summary := entry.Summary()
+		if !filter.Match(summary) {
+			continue
+		}
+		if err := websocket.JSON.Send(ws, summary); err != nil {
+			break
+		}
+	}
+	DebugLog("DebugerAdmin live is stopped from %v", ws.Request().RemoteAddr)
+}
@@ -0,0 +1,236 @@
+package webdebugger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestDebugerAdmin(t *testing.T) {
+	debugger := NewDebuger(&Config{Capture: &CaptureConfig{}})
+	admin := NewDebugerAdmin(debugger)
+	password, _ := HashPassword(HashSHA1, "123")
+	admin.Username, admin.Password = "abc", password
+	addEntry := func(method, url string, status int) {
+		debugger.Capture.Add(&CaptureEntry{
+			Started:  time.Now(),
+			Request:  &CaptureMessage{Method: method, URL: url, Header: http.Header{}},
+			Response: &CaptureMessage{Status: status, Header: http.Header{}, Body: []byte("ok"), BodySize: 2},
+		})
+	}
+	addEntry("GET", "https://a.snows.io/x", 200)
+	addEntry("POST", "https://b.snows.io/x", 404)
+	go http.ListenAndServe(":10070", admin)
+	time.Sleep(100 * time.Millisecond)
+	request := func(method, path string) (status int, data string) {
+		req, _ := http.NewRequest(method, "http://127.0.0.1:10070"+path, nil)
+		req.SetBasicAuth("abc", "123")
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Origin", "http://127.0.0.1:10070")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+		d, _ := ioutil.ReadAll(resp.Body)
+		status, data = resp.StatusCode, string(d)
+		return
+	}
+	//auth
+	if resp, err := http.Get("http://127.0.0.1:10070/"); err != nil || resp.StatusCode != 401 {
+		t.Errorf("err:%v", err)
+		return
+	}
+	//ui
+	if status, data := request("GET", "/"); status != 200 || !strings.Contains(data, "Web Debugger") {
+		t.Errorf("status:%v", status)
+		return
+	}
+	//list
+	summaries := []*CaptureSummary{}
+	_, data := request("GET", "/api/captures")
+	json.Unmarshal([]byte(data), &summaries)
+	if len(summaries) != 2 || summaries[0].Host != "a.snows.io" {
+		t.Errorf("data:%v", data)
+		return
+	}
+	for _, query := range []string{"host=b.snows", "status=4xx", "status=404", "method=post"} {
+		summaries = []*CaptureSummary{}
+		_, data = request("GET", "/api/captures?"+query)
+		json.Unmarshal([]byte(data), &summaries)
+		if len(summaries) != 1 || summaries[0].ID != 2 {
+			t.Errorf("query:%v,data:%v", query, data)
+			return
+		}
+	}
+	//detail
+	entry := &HAREntry{}
+	_, data = request("GET", "/api/captures/1")
+	json.Unmarshal([]byte(data), entry)
+	if entry.ID != 1 || entry.Response.Content.Text != "ok" {
+		t.Errorf("data:%v", data)
+		return
+	}
+	if status, _ := request("GET", "/api/captures/100"); status != 404 {
+		t.Errorf("status:%v", status)
+		return
+	}
+	if status, _ := request("GET", "/api/captures/xx"); status != 404 {
+		t.Errorf("status:%v", status)
+		return
+	}
+	//har
+	har := &HAR{}
+	_, data = request("GET", "/api/har")
+	json.Unmarshal([]byte(data), har)
+	if len(har.Log.Entries) != 2 {
+		t.Errorf("data:%v", data)
+		return
+	}
+	har = &HAR{}
+	_, data = request("GET", "/api/har?id=2")
+	json.Unmarshal([]byte(data), har)
+	if len(har.Log.Entries) != 1 || har.Log.Entries[0].ID != 2 {
+		t.Errorf("data:%v", data)
+		return
+	}
+	if status, _ := request("GET", "/api/har?id=100"); status != 404 {
+		t.Errorf("status:%v", status)
+		return
+	}
+	//replay
+	if status, data := request("POST", "/api/replay?id=1"); status != 400 || !strings.Contains(data, "not configured") {
+		t.Errorf("status:%v,data:%v", status, data)
+		return
+	}
+	if status, _ := request("POST", "/api/replay?id=xx"); status != 400 {
+		t.Errorf("status:%v", status)
+		return
+	}
+	//cross-site
+	crossSite := func(method, path, contentType, origin string) (status int) {
+		req, _ := http.NewRequest(method, "http://127.0.0.1:10070"+path, strings.NewReader(`{"forward":"http://evil.snows.io"}`))
+		req.SetBasicAuth("abc", "123")
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Origin", origin)
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			status = resp.StatusCode
+			resp.Body.Close()
+		}
+		return
+	}
+	if status := crossSite("POST", "/api/replay?id=1", "text/plain", "http://127.0.0.1:10070"); status != 415 {
+		t.Errorf("status:%v", status)
+		return
+	}
+	if status := crossSite("POST", "/api/replay?id=1", "application/json", "http://evil.snows.io"); status != 403 {
+		t.Errorf("status:%v", status)
+		return
+	}
+	if status := crossSite("POST", "/api/holds/1", "text/plain", "http://127.0.0.1:10070"); status != 415 {
+		t.Errorf("status:%v", status)
+		return
+	}
+	if status := crossSite("POST", "/api/holds/1", "application/json", "http://evil.snows.io"); status != 403 {
+		t.Errorf("status:%v", status)
+		return
+	}
+	if status := crossSite("DELETE", "/api/captures", "", "null"); status != 403 || len(debugger.Capture.List()) != 2 {
+		t.Errorf("status:%v", status)
+		return
+	}
+	//dns rebinding
+	req, _ := http.NewRequest("GET", "http://127.0.0.1:10070/api/captures", nil)
+	req.Host = "evil.snows.io:10070"
+	req.SetBasicAuth("abc", "123")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != 403 {
+		t.Errorf("err:%v", err)
+		return
+	}
+	for host, allowed := range map[string]bool{
+		"localhost:10070": true,
+		"[::1]:10070":     true,
+		"127.0.0.1":       true,
+		"evil.snows.io":   false,
+		"10.0.0.1:10070":  false,
+	} {
+		if admin.allowHost(host) != allowed {
+			t.Errorf("host:%v", host)
+			return
+		}
+	}
+	admin.Hosts = []string{"admin.snows.io:10070"}
+	if !admin.allowHost("ADMIN.snows.io:10070") || admin.allowHost("10.0.0.1:10070") {
+		t.Error("error")
+		return
+	}
+	admin.Hosts = []string{"0.0.0.0:10070"}
+	if !admin.allowHost("10.0.0.1:10070") || admin.allowHost("evil.snows.io:10070") {
+		t.Error("error")
+		return
+	}
+	admin.Hosts = nil
+	//holds
+	if status, data := request("GET", "/api/holds"); status != 200 || data != "[]" {
+		t.Errorf("status:%v,data:%v", status, data)
+		return
+	}
+	if status, _ := request("POST", "/api/holds/1"); status != 400 {
+		t.Errorf("status:%v", status)
+		return
+	}
+	if status, _ := request("POST", "/api/holds/xx"); status != 400 {
+		t.Errorf("status:%v", status)
+		return
+	}
+	//live
+	config, _ := websocket.NewConfig("ws://127.0.0.1:10070/api/live?method=put", "http://127.0.0.1:10070/")
+	config.Header.Set("Authorization", "Basic YWJjOjEyMw==")
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	time.Sleep(100 * time.Millisecond)
+	addEntry("GET", "https://a.snows.io/y", 200)
+	addEntry("PUT", "https://a.snows.io/z", 200)
+	summary := &CaptureSummary{}
+	err = websocket.JSON.Receive(ws, summary)
+	if err != nil || summary.ID != 4 || summary.Method != "PUT" {
+		t.Errorf("err:%v,summary:%v", err, summary)
+		return
+	}
+	ws.Close()
+	//other origin
+	config, _ = websocket.NewConfig("ws://127.0.0.1:10070/api/live", "http://evil.snows.io/")
+	config.Header.Set("Authorization", "Basic YWJjOjEyMw==")
+	if _, err = websocket.DialConfig(config); err == nil {
+		t.Error("error")
+		return
+	}
+	//clear
+	if status, _ := request("DELETE", "/api/captures"); status != 200 || len(debugger.Capture.List()) != 0 {
+		t.Errorf("status:%v", status)
+		return
+	}
+	if status, _ := request("GET", "/api/xx"); status != 404 {
+		t.Errorf("status:%v", status)
+		return
+	}
+	//capture is not configured
+	debugger.Capture = nil
+	if status, data := request("GET", "/api/captures"); status != 404 || !strings.Contains(data, "not configured") {
+		t.Errorf("status:%v,data:%v", status, data)
+		return
+	}
+	if status, _ := request("GET", "/api/holds"); status != 200 {
+		t.Errorf("status:%v", status)
+		return
+	}
+}
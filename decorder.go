@@ -1,7 +1,11 @@
 package webdebugger
 
 import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/subtle"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -9,7 +13,9 @@ import (
 	"net"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 )
 
 //Decorder is an interface to decord raw connection by host
@@ -20,7 +26,7 @@ type Decorder interface {
 //DecorderCreator is a func define to create Decorder by configure
 type DecorderCreator func(name string, config map[string]interface{}) (decorder Decorder, err error)
 
-//DefaultDecorderCreator will create Decorder by name, supported type is TlsDecorder
+//DefaultDecorderCreator will create Decorder by name, supported type is TlsDecorder/RemoteTlsDecorder/CADecorder
 func DefaultDecorderCreator(name string, config map[string]interface{}) (decorder Decorder, err error) {
 	if config == nil {
 		err = fmt.Errorf("the %v decorder config is not setted", name)
@@ -34,8 +40,49 @@ func DefaultDecorderCreator(name string, config map[string]interface{}) (decorde
 		d.Server, _ = config["server"].(string)
 		d.Username, _ = config["username"].(string)
 		d.Password, _ = config["password"].(string)
+		d.Token, _ = config["token"].(string)
+		d.PSK, _ = config["psk"].(string)
+		d.WrapKey, _ = config["wrap_key"].(bool)
 		d.Cert, _ = config["cert"].(string)
 		d.Key, _ = config["key"].(string)
+		d.ClientCert, _ = config["client_cert"].(string)
+		d.ClientKey, _ = config["client_key"].(string)
+		d.ServerCA, _ = config["server_ca"].(string)
+		if v, ok := config["check_interval"].(float64); ok {
+			d.CheckInterval = time.Duration(v) * time.Second
+		}
+		if v, ok := config["refresh_before"].(float64); ok {
+			d.RefreshBefore = time.Duration(v) * time.Second
+		}
+		if v, ok := config["warn_before"].(float64); ok {
+			d.WarnBefore = time.Duration(v) * time.Second
+		}
+		if v, ok := config["fail_cache"].(float64); ok {
+			d.FailCache = time.Duration(v) * time.Second
+		}
+		if v, ok := config["max_certs"].(float64); ok {
+			d.MaxCerts = int(v)
+		}
+		decorder = d
+	case "RemoteTlsDecorder":
+		d := NewRemoteTLSDecorder()
+		d.Name, _ = config["name"].(string)
+		d.Server, _ = config["server"].(string)
+		d.Username, _ = config["username"].(string)
+		d.Password, _ = config["password"].(string)
+		d.Token, _ = config["token"].(string)
+		d.ClientCert, _ = config["client_cert"].(string)
+		d.ClientKey, _ = config["client_key"].(string)
+		d.ServerCA, _ = config["server_ca"].(string)
+		decorder = d
+	case "CADecorder":
+		d := NewCADecorder()
+		d.Name, _ = config["name"].(string)
+		d.CACert, _ = config["ca_cert"].(string)
+		d.CAKey, _ = config["ca_key"].(string)
+		if v, ok := config["max_certs"].(float64); ok {
+			d.MaxCerts = int(v)
+		}
 		decorder = d
 	default:
 		err = fmt.Errorf("the %v decorder is not supported", decorderType)
@@ -43,62 +90,96 @@ func DefaultDecorderCreator(name string, config map[string]interface{}) (decorde
 	return
 }
 
-//TLSCertCenter provider cert server and it will service the TLSDecorder
+//TLSCertCenter provider cert server and it will service the TLSDecorder,
+//the cert response is sent with ETag and Cache-Control max-age by MaxAge for client refreshing.
+//the host configure can limit the client certificate subjects by clients when it is served on https with client verifying,
+//see NewClientAuthTLSConfig.
+//the request can be authorized by bearer token with cert/decord scope in Tokens, or basic auth by the host configure
+//username/password, the password is hashed by HashPassword.
+//the private key is wrapped by the host configure psk or the client public key in KeyWrapHeader,
+//and the raw key is never sent when RequireWrap is true.
+//the host configure can be managed on /admin/certs by token with admin scope, see TLSCertCenter.admin,
+//the uploaded cert/key is saved to Store when it is setted, else to CertDir
 type TLSCertCenter struct {
-	certs    []map[string]interface{}
-	loaded   map[string]*tls.Config
-	certsLck sync.RWMutex
+	MaxAge      time.Duration
+	Tokens      []*AuthToken
+	RequireWrap bool
+	Store       CertStore                                        //the store to load cert/key when host configure is not setted cert/key file
+	CertDir     string                                           //the directory to save uploaded cert/key
+	Persist     func(certs []map[string]interface{}) (err error) //the func to persist host configure after changed by admin
+	certs       []map[string]interface{}
+	certsLck    sync.RWMutex
 }
 
 //NewTLSCertCenter will return new TLSCertCenter by cert configure
 func NewTLSCertCenter(certs ...map[string]interface{}) (center *TLSCertCenter) {
 	center = &TLSCertCenter{
+		MaxAge:   time.Hour,
 		certs:    certs,
-		loaded:   map[string]*tls.Config{},
 		certsLck: sync.RWMutex{},
 	}
 	return
 }
 
+//NewClientAuthTLSConfig will return the server tls config to require and verify client certificate by CA file
+func NewClientAuthTLSConfig(clientCA string) (config *tls.Config, err error) {
+	pool, err := LoadCertPool(clientCA)
+	if err != nil {
+		return
+	}
+	config = &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	}
+	return
+}
+
 func (t *TLSCertCenter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	host, cert, key, ok := t.auth(w, r)
-	if !ok {
+	if strings.HasPrefix(r.URL.Path, "/admin/") {
+		t.admin(w, r)
 		return
 	}
 	_, call := filepath.Split(r.URL.Path)
-	switch call {
-	// case "decord":
-	// 	t.decord(w, r, host, cert, key)
-	case "cert":
-		t.cert(w, r, host, cert, key)
-	default:
+	if call != "cert" && call != "decord" {
 		w.WriteHeader(404)
 		fmt.Fprintf(w, "%v is not supported", call)
+		return
+	}
+	host, conf, ok := t.auth(w, r, call)
+	if !ok {
+		return
+	}
+	switch call {
+	case "decord":
+		t.decord(w, r, host, conf)
+	case "cert":
+		t.cert(w, r, host, conf)
 	}
 }
 
-func (t *TLSCertCenter) auth(w http.ResponseWriter, r *http.Request) (host, cert, key string, ok bool) {
+//auth will find the best matched host configure by host parameter and check the request is allowed to access it,
+//the bearer token must have the scope on host
+func (t *TLSCertCenter) auth(w http.ResponseWriter, r *http.Request, scope string) (host string, conf map[string]interface{}, ok bool) {
 	host = r.URL.Query().Get("host")
 	if len(host) < 1 {
 		w.WriteHeader(400)
 		fmt.Fprintf(w, "host parameter is requred")
 		return
 	}
-	var conf map[string]interface{}
 	var username, password string
+	var clients []string
 	t.certsLck.RLock()
+	best := rankNone
 	for _, c := range t.certs {
 		h, _ := c["host"].(string)
-		if host == h {
-			conf = c
-			break
+		if rank := matchPattern(h, host); rank < best {
+			best, conf = rank, c
 		}
 	}
 	if conf != nil {
 		username, _ = conf["username"].(string)
 		password, _ = conf["password"].(string)
-		cert, _ = conf["cert"].(string)
-		key, _ = conf["key"].(string)
+		clients = stringList(conf["clients"])
 	}
 	t.certsLck.RUnlock()
 	if conf == nil {
@@ -106,9 +187,33 @@ func (t *TLSCertCenter) auth(w http.ResponseWriter, r *http.Request) (host, cert
 		fmt.Fprintf(w, "host config is not exists")
 		return
 	}
+	if len(clients) > 0 && !matchClient(clients, r) {
+		WarnLog("TlsCertCenter the client %v is not allowed to access %v", r.RemoteAddr, host)
+		w.WriteHeader(403)
+		fmt.Fprintf(w, "client is not allowed")
+		return
+	}
+	if token, bearer := bearerToken(r); bearer {
+		found := findToken(t.Tokens, token)
+		if found == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="Web Debugger"`)
+			w.WriteHeader(401)
+			w.Write([]byte("Invalid Token.\n"))
+			return
+		}
+		if !found.Allow(scope, host) {
+			WarnLog("TlsCertCenter the token %v is not allowed to access %v", found.Name, host)
+			w.WriteHeader(403)
+			w.Write([]byte("Scope Required.\n"))
+			return
+		}
+		ok = true
+		return
+	}
 	if len(username) > 0 {
 		u, p, _ := r.BasicAuth()
-		if u != username || SHA1([]byte(p)) != password {
+		userMatched := subtle.ConstantTimeCompare([]byte(u), []byte(username)) == 1
+		if !VerifyPassword(password, p) || !userMatched {
 			w.Header().Set("WWW-Authenticate", `Basic realm="Web Debugger"`)
 			w.WriteHeader(401)
 			w.Write([]byte("Login Required.\n"))
@@ -119,106 +224,497 @@ func (t *TLSCertCenter) auth(w http.ResponseWriter, r *http.Request) (host, cert
 	return
 }
 
-// func (t *TLSCertCenter) decord(w http.ResponseWriter, r *http.Request, host, cert, key string) {
-// server := websocket.Server{Handler: func(ws *websocket.Conn) {
-// 	config, err := t.tlsConfig(host, cert, key)
-// 	if err != nil {
-// 		WarnLog("TlsCertCenter load tls config by host:%v,cert:%v,key:%v fail with %v", host, cert, key, err)
-// 		return
-// 	}
-// 	DebugLog("TlsCertCenter start decord conn to %v from %v", host, r.RemoteAddr)
-// 	// conn := tls.Server(ws, config)
-// 	// io.Copy(conn, conn)
-// }}
-// server.ServeHTTP(w, r)
-// }
-
-// func (t *TLSCertCenter) tlsConfig(host, certFile, keyFile string) (config *tls.Config, err error) {
-// 	t.certsLck.RLock()
-// 	config = t.loaded[host]
-// 	t.certsLck.RUnlock()
-// 	if config != nil {
-// 		return
-// 	}
-// 	config = &tls.Config{}
-// 	config.NextProtos = append(config.NextProtos, "http/1.1")
-// 	config.Certificates = make([]tls.Certificate, 1)
-// 	config.Certificates[0], err = tls.LoadX509KeyPair(certFile, keyFile)
-// 	return
-// }
-
-func (t *TLSCertCenter) cert(w http.ResponseWriter, r *http.Request, host, cert, key string) {
-	if len(cert) < 1 || len(key) < 1 {
-		w.WriteHeader(500)
-		fmt.Fprintf(w, "host config is invalid")
-		WarnLog("TlsCertCenter the %v config is missing cert/key", host)
-		return
+//matchClient will check the verified client certificate subject is in clients, the client is common name or subject like CN=xx,O=xx
+func matchClient(clients []string, r *http.Request) bool {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) < 1 || len(r.TLS.VerifiedChains[0]) < 1 {
+		return false
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	for _, client := range clients {
+		if client == subject.CommonName || client == subject.String() {
+			return true
+		}
+	}
+	return false
+}
+
+func stringList(v interface{}) (list []string) {
+	switch vals := v.(type) {
+	case []string:
+		list = vals
+	case []interface{}:
+		for _, val := range vals {
+			if s, ok := val.(string); ok {
+				list = append(list, s)
+			}
+		}
+	case string:
+		list = []string{vals}
+	}
+	return
+}
+
+//loadCert will load the cert/key of host configure from file, or from Store by the configured host when cert/key file is not setted
+func (t *TLSCertCenter) loadCert(conf map[string]interface{}) (certBytes, keyBytes []byte, err error) {
+	pattern, _ := conf["host"].(string)
+	cert, _ := conf["cert"].(string)
+	key, _ := conf["key"].(string)
+	switch {
+	case len(cert) > 0 && len(key) > 0:
+		certBytes, err = ioutil.ReadFile(cert)
+		if err == nil {
+			keyBytes, err = ioutil.ReadFile(key)
+		}
+	case t.Store != nil:
+		certBytes, keyBytes, err = t.Store.Load(pattern)
+	default:
+		err = fmt.Errorf("the config is missing cert/key")
 	}
-	certBytes, err := ioutil.ReadFile(cert)
+	return
+}
+
+func (t *TLSCertCenter) cert(w http.ResponseWriter, r *http.Request, host string, conf map[string]interface{}) {
+	psk, _ := conf["psk"].(string)
+	certBytes, keyBytes, err := t.loadCert(conf)
 	if err != nil {
 		w.WriteHeader(500)
 		fmt.Fprintf(w, "host config is invalid")
-		WarnLog("TlsCertCenter the %v config read cert from %v fail with %v", host, cert, err)
+		WarnLog("TlsCertCenter the %v config load cert fail with %v", host, err)
 		return
 	}
-	keyBytes, err := ioutil.ReadFile(key)
-	if err != nil {
-		w.WriteHeader(500)
-		fmt.Fprintf(w, "host config is invalid")
-		WarnLog("TlsCertCenter the %v config read key from %v fail with %v", host, key, err)
+	etag := fmt.Sprintf(`"%v"`, SHA1(append(append([]byte{}, certBytes...), keyBytes...)))
+	w.Header().Set("ETag", etag)
+	if t.MaxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%v", int(t.MaxAge/time.Second)))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(304)
 		return
 	}
-	outBytes, _ := json.Marshal(map[string]interface{}{
+	certInfo := map[string]interface{}{
 		"host": host,
 		"cert": certBytes,
-		"key":  keyBytes,
-	})
+	}
+	clientPub := r.Header.Get(KeyWrapHeader)
+	switch {
+	case len(psk) > 0:
+		certInfo["wrap"] = KeyWrapPSK
+		certInfo["salt"], certInfo["wrapped_key"], err = wrapKeyPSK(psk, keyBytes, host)
+	case len(clientPub) > 0:
+		var pub []byte
+		pub, err = base64.StdEncoding.DecodeString(clientPub)
+		if err == nil {
+			certInfo["wrap"] = KeyWrapX25519
+			certInfo["epk"], certInfo["wrapped_key"], err = wrapKeyX25519(pub, keyBytes, host)
+		}
+		if err != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "invalid public key")
+			return
+		}
+	case t.RequireWrap:
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "key wrapping is required")
+		return
+	default:
+		certInfo["key"] = keyBytes
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		fmt.Fprintf(w, "wrap key fail")
+		WarnLog("TlsCertCenter the %v wrap key fail with %v", host, err)
+		return
+	}
+	outBytes, _ := json.Marshal(certInfo)
+	w.Header().Set("Content-Type", "application/json")
 	w.Write(outBytes)
 }
 
-//TLSDecorder provider Decorder to decord conenction by tls cert
+//TLSDecorderMaxCerts is the default max number of certificate cached by TLSDecorder
+const TLSDecorderMaxCerts = 1024
+
+//TLSDecorder provider Decorder to decord conenction by tls cert,
+//the loaded certificate is refreshed in background by CheckInterval/max-age and before expired by RefreshBefore.
+//the loading fail is cached in FailCache and the least recently used certificate is removed when MaxCerts is reached.
+//the ClientCert/ClientKey is sent to https cert server and the server certificate is verified only by ServerCA when it is setted
 type TLSDecorder struct {
-	Name      string
-	Server    string
-	Username  string
-	Password  string
-	Cert, Key string
-	loaded    *tls.Config
-	locker    sync.RWMutex
+	Name            string
+	Server          string
+	Username        string
+	Password        string
+	Token           string
+	PSK             string //the pre-shared secret to unwrap key
+	WrapKey         bool   //request the key wrapped by ephemeral X25519 key
+	Cert, Key       string
+	ClientCert      string
+	ClientKey       string
+	ServerCA        string
+	CheckInterval   time.Duration //the interval to check certificate changed when max-age is not responsed
+	RefreshBefore   time.Duration //the duration to refresh certificate before it is expired
+	RefreshInterval time.Duration //the interval of background refresh loop, it will be disabled when is zero
+	WarnBefore      time.Duration //the duration to warn certificate will be expired
+	FailCache       time.Duration //the duration to cache the loading fail, it will be disabled when is zero
+	MaxCerts        int           //the max number of cached certificate, it will be unlimited when is zero
+	OnExpiring      func(host string, leaf *x509.Certificate)
+	certs           map[string]*tlsCertEntry
+	fails           map[string]*tlsCertFail
+	client          *http.Client
+	locker          sync.RWMutex
+	refreshing      bool
+	closed          chan int
+}
+
+type tlsCertEntry struct {
+	*tls.Certificate
+	host   string
+	etag   string
+	next   time.Time
+	used   time.Time
+	warned bool
+}
+
+type tlsCertFail struct {
+	err   error
+	until time.Time
 }
 
 //NewTLSDecorder will create new TLSDecorder
 func NewTLSDecorder() (decorder *TLSDecorder) {
 	decorder = &TLSDecorder{
-		locker: sync.RWMutex{},
+		CheckInterval:   time.Hour,
+		RefreshBefore:   24 * time.Hour,
+		RefreshInterval: time.Minute,
+		WarnBefore:      7 * 24 * time.Hour,
+		FailCache:       30 * time.Second,
+		MaxCerts:        TLSDecorderMaxCerts,
+		certs:           map[string]*tlsCertEntry{},
+		fails:           map[string]*tlsCertFail{},
+		locker:          sync.RWMutex{},
+		closed:          make(chan int),
 	}
 	return
 }
 
-//Decord will decord raw connection by host
+//Decord will decord raw connection by host, the certificate is always loaded for the host matched by route,
+//the SNI sent by client is only checked to be same as host name, so the client can't make it load certificate for other name
 func (t *TLSDecorder) Decord(host string, raw net.Conn) (conn net.Conn, err error) {
-	t.locker.Lock()
-	defer t.locker.Unlock()
-	if t.loaded != nil {
-		conn = tls.Server(raw, t.loaded)
+	_, err = t.certificate(host)
+	if err != nil {
 		return
 	}
+	name, _ := splitHostPort(host)
 	config := &tls.Config{}
 	config.NextProtos = append(config.NextProtos, "http/1.1")
-	config.Certificates = make([]tls.Certificate, 1)
+	config.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if len(hello.ServerName) > 0 && !strings.EqualFold(hello.ServerName, name) {
+			DebugLog("TLSDecorder the SNI %v is not matched to %v, using certificate of %v", hello.ServerName, host, host)
+		}
+		return t.certificate(host)
+	}
+	conn = tls.Server(raw, config)
+	return
+}
+
+//Close will stop the background refresh
+func (t *TLSDecorder) Close() (err error) {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	select {
+	case <-t.closed:
+	default:
+		close(t.closed)
+	}
+	return
+}
+
+func (t *TLSDecorder) certKey(host string) string {
 	if len(t.Cert) > 0 && len(t.Key) > 0 {
-		config.Certificates[0], err = tls.LoadX509KeyPair(t.Cert, t.Key)
+		return ""
+	}
+	return strings.ToLower(host)
+}
+
+//certificate will return the cached certificate by host or load it when it is not cached or expired
+func (t *TLSDecorder) certificate(host string) (cert *tls.Certificate, err error) {
+	key := t.certKey(host)
+	now := time.Now()
+	t.locker.Lock()
+	entry := t.certs[key]
+	if entry != nil {
+		entry.used = now
+	}
+	fail := t.fails[key]
+	t.locker.Unlock()
+	if entry == nil && fail != nil && now.Before(fail.until) {
+		err = fail.err
+		return
+	}
+	if entry == nil || !now.Before(entry.Leaf.NotAfter) {
+		entry, err = t.refresh(key, host, entry)
 		if err != nil {
-			InfoLog("TLSDecorder load X509KeyPair file fail with %v", t.Server, err)
+			t.cacheFail(key, err)
 			return
 		}
+	}
+	cert = entry.Certificate
+	return
+}
+
+//cacheFail will cache the loading fail by FailCache, the expired fails is removed when it is full
+func (t *TLSDecorder) cacheFail(key string, err error) {
+	if t.FailCache <= 0 {
+		return
+	}
+	now := time.Now()
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	if t.MaxCerts > 0 && len(t.fails) >= t.MaxCerts {
+		for k, fail := range t.fails {
+			if !now.Before(fail.until) {
+				delete(t.fails, k)
+			}
+		}
+		if len(t.fails) >= t.MaxCerts {
+			return
+		}
+	}
+	t.fails[key] = &tlsCertFail{err: err, until: now.Add(t.FailCache)}
+}
+
+//evictCert will remove the least recently used certificate, it must be called with locker
+func (t *TLSDecorder) evictCert() {
+	var oldest *tlsCertEntry
+	var oldestKey string
+	for key, entry := range t.certs {
+		if oldest == nil || entry.used.Before(oldest.used) {
+			oldestKey, oldest = key, entry
+		}
+	}
+	delete(t.certs, oldestKey)
+	DebugLog("TLSDecorder remove certificate of %v by max %v", oldest.host, t.MaxCerts)
+}
+
+//refresh will load the certificate by etag of old entry and replace the cached entry
+func (t *TLSDecorder) refresh(key, host string, old *tlsCertEntry) (entry *tlsCertEntry, err error) {
+	var etag string
+	if old != nil {
+		etag = old.etag
+	}
+	cert, etag, maxAge, err := t.loadCertificate(host, etag)
+	if err != nil {
+		return
+	}
+	entry = &tlsCertEntry{Certificate: cert, host: host, etag: etag}
+	if cert == nil { //not modified
+		entry.Certificate = old.Certificate
 	} else {
+		DebugLog("TLSDecorder load certificate for %v expired at %v", host, cert.Leaf.NotAfter)
+	}
+	if maxAge <= 0 {
+		maxAge = t.CheckInterval
+	}
+	now := time.Now()
+	entry.next = now.Add(maxAge)
+	if renew := entry.Leaf.NotAfter.Add(-t.RefreshBefore); renew.Before(entry.next) {
+		entry.next = renew
+		if entry.next.Before(now.Add(t.RefreshInterval)) {
+			entry.next = now.Add(t.RefreshInterval)
+		}
+	}
+	t.locker.Lock()
+	if cert == nil {
+		entry.warned = old.warned
+	}
+	_, having := t.certs[key]
+	if old != nil {
+		entry.used = old.used
+	} else {
+		entry.used = now
+	}
+	if old != nil && !having { //removed by max certs when refreshing
+		t.locker.Unlock()
+		return
+	}
+	if !having && t.MaxCerts > 0 && len(t.certs) >= t.MaxCerts {
+		t.evictCert()
+	}
+	t.certs[key] = entry
+	delete(t.fails, key)
+	if !t.refreshing && t.RefreshInterval > 0 {
+		t.refreshing = true
+		go t.loopRefresh()
+	}
+	t.locker.Unlock()
+	t.checkExpiring(key, entry)
+	return
+}
+
+func (t *TLSDecorder) loopRefresh() {
+	ticker := time.NewTicker(t.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.closed:
+			return
+		case <-ticker.C:
+			t.refreshCertificates()
+		}
+	}
+}
+
+//refreshCertificates will refresh all cached certificates which is reached the next checking time
+func (t *TLSDecorder) refreshCertificates() {
+	entries := map[string]*tlsCertEntry{}
+	t.locker.RLock()
+	for key, entry := range t.certs {
+		entries[key] = entry
+	}
+	t.locker.RUnlock()
+	now := time.Now()
+	for key, entry := range entries {
+		if now.Before(entry.next) {
+			continue
+		}
+		_, err := t.refresh(key, entry.host, entry)
+		if err != nil {
+			WarnLog("TLSDecorder refresh certificate for %v fail with %v", entry.host, err)
+			t.checkExpiring(key, entry)
+		}
+	}
+}
+
+//checkExpiring will warn once when the certificate is expired in WarnBefore
+func (t *TLSDecorder) checkExpiring(key string, entry *tlsCertEntry) {
+	if time.Now().Add(t.WarnBefore).Before(entry.Leaf.NotAfter) {
+		return
+	}
+	t.locker.Lock()
+	warned := entry.warned
+	entry.warned = true
+	t.locker.Unlock()
+	if warned {
+		return
+	}
+	WarnLog("TLSDecorder the certificate for %v will be expired at %v", entry.host, entry.Leaf.NotAfter)
+	if t.OnExpiring != nil {
+		t.OnExpiring(entry.host, entry.Leaf)
+	}
+}
+
+//unwrapKey will return the key from cert info, the key must be wrapped when PSK or WrapKey is setted
+func (t *TLSDecorder) unwrapKey(certInfo map[string]interface{}, host string, wrapKey *ecdh.PrivateKey) (key []byte, err error) {
+	wrap, _ := certInfo["wrap"].(string)
+	decode := func(name string) (data []byte) {
+		encoded, _ := certInfo[name].(string)
+		data, _ = base64.StdEncoding.DecodeString(encoded)
+		return
+	}
+	switch {
+	case wrap == KeyWrapPSK && len(t.PSK) > 0:
+		key, err = unwrapKeyPSK(t.PSK, decode("salt"), decode("wrapped_key"), host)
+	case wrap == KeyWrapX25519 && wrapKey != nil:
+		key, err = unwrapKeyX25519(wrapKey, decode("epk"), decode("wrapped_key"), host)
+	case len(wrap) > 0:
+		err = fmt.Errorf("the key wrap %v is not supported", wrap)
+	case len(t.PSK) > 0 || t.WrapKey:
+		err = fmt.Errorf("the key is not wrapped")
+	default:
+		key = decode("key")
+	}
+	return
+}
+
+//httpClient will return the http client to cert server with client certificate and pinned server CA
+func (t *TLSDecorder) httpClient() (client *http.Client, err error) {
+	if len(t.ClientCert) < 1 && len(t.ServerCA) < 1 {
+		return
+	}
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	if t.client != nil {
+		client = t.client
+		return
+	}
+	config, err := newClientTLSConfig(t.ClientCert, t.ClientKey, t.ServerCA)
+	if err != nil {
+		return
+	}
+	t.client = &http.Client{
+		Transport: &http.Transport{TLSClientConfig: config, Proxy: http.ProxyFromEnvironment},
+		Timeout:   time.Minute,
+	}
+	client = t.client
+	return
+}
+
+//newClientTLSConfig will return the tls config to cert server with client certificate and pinned server CA
+func newClientTLSConfig(clientCert, clientKey, serverCA string) (config *tls.Config, err error) {
+	config = &tls.Config{}
+	if len(clientCert) > 0 {
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if len(serverCA) > 0 {
+		config.RootCAs, err = LoadCertPool(serverCA)
+	}
+	return
+}
+
+//loadCertificate will load certificate from file or server, the cert is nil when server response not modified by etag
+func (t *TLSDecorder) loadCertificate(host, etag string) (cert *tls.Certificate, newEtag string, maxAge time.Duration, err error) {
+	var pair tls.Certificate
+	if len(t.Cert) > 0 && len(t.Key) > 0 {
+		pair, err = tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			InfoLog("TLSDecorder load X509KeyPair file fail with %v", err)
+			return
+		}
+	} else {
+		header := http.Header{}
+		if len(t.Token) > 0 {
+			header.Set("Authorization", "Bearer "+t.Token)
+		}
+		if len(etag) > 0 {
+			header.Set("If-None-Match", etag)
+		}
+		var wrapKey *ecdh.PrivateKey
+		if t.WrapKey {
+			wrapKey, err = ecdh.X25519().GenerateKey(rand.Reader)
+			if err != nil {
+				return
+			}
+			header.Set(KeyWrapHeader, base64.StdEncoding.EncodeToString(wrapKey.PublicKey().Bytes()))
+		}
+		var status int
+		var respHeader http.Header
 		var certData []byte
-		certData, err = httpGet(fmt.Sprintf(t.Server, host), t.Username, t.Password)
+		var client *http.Client
+		client, err = t.httpClient()
+		if err != nil {
+			InfoLog("TLSDecorder load client cert:%v,key:%v,server ca:%v fail with %v", t.ClientCert, t.ClientKey, t.ServerCA, err)
+			return
+		}
+		status, respHeader, certData, err = httpGetHeader(client, fmt.Sprintf(t.Server, host), t.Username, t.Password, header)
 		if err != nil {
 			InfoLog("TLSDecorder send request by %v fail with %v", t.Server, err)
 			return
 		}
+		if status == 401 || status == 403 {
+			err = fmt.Errorf("access to %v is denied by %v", host, strings.TrimSpace(string(certData)))
+			InfoLog("TLSDecorder send request by %v fail with %v", t.Server, err)
+			return
+		}
+		newEtag, maxAge = respHeader.Get("ETag"), parseMaxAge(respHeader)
+		if status == 304 && len(etag) > 0 {
+			newEtag = etag
+			return
+		}
 		certInfo := map[string]interface{}{}
 		err = json.Unmarshal(certData, &certInfo)
 		if err != nil {
@@ -226,16 +722,26 @@ func (t *TLSDecorder) Decord(host string, raw net.Conn) (conn net.Conn, err erro
 			return
 		}
 		certEncoded, _ := certInfo["cert"].(string)
-		cert, _ := base64.StdEncoding.DecodeString(certEncoded)
-		keyEncoded, _ := certInfo["key"].(string)
-		key, _ := base64.StdEncoding.DecodeString(keyEncoded)
-		config.Certificates[0], err = tls.X509KeyPair(cert, key)
+		certBytes, _ := base64.StdEncoding.DecodeString(certEncoded)
+		var keyBytes []byte
+		keyBytes, err = t.unwrapKey(certInfo, host, wrapKey)
+		if err != nil {
+			InfoLog("TLSDecorder unwrap key for %v fail with %v", host, err)
+			return
+		}
+		pair, err = tls.X509KeyPair(certBytes, keyBytes)
 		if err != nil {
 			InfoLog("TLSDecorder load X509KeyPair fail with %v", err)
 			return
 		}
 	}
-	t.loaded = config
-	conn = tls.Server(raw, t.loaded)
+	pair.Leaf, err = x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return
+	}
+	if time.Now().After(pair.Leaf.NotAfter) {
+		WarnLog("TLSDecorder the certificate for %v is expired at %v", host, pair.Leaf.NotAfter)
+	}
+	cert = &pair
 	return
 }
@@ -1,2 +1,408 @@
 package webdebugger
 
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCert(dir, name string, cert *tls.Certificate) (certFile, keyFile string) {
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	keyDer, _ := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0644)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600)
+	return
+}
+
+func TestTLSDecorder(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wdebugger")
+	defer os.RemoveAll(dir)
+	ca, _ := GenerateCA("test")
+	certA, _ := ca.Issue("a.snows.io")
+	certB, _ := ca.Issue("b.snows.io")
+	certFileA, keyFileA := writeTestCert(dir, "a", certA)
+	certFileB, keyFileB := writeTestCert(dir, "b", certB)
+	center := NewTLSCertCenter(
+		map[string]interface{}{"host": "a.snows.io:443", "cert": certFileA, "key": keyFileA},
+		map[string]interface{}{"host": "b.snows.io:443", "cert": certFileB, "key": keyFileB},
+	)
+	go http.ListenAndServe(":10061", center)
+	time.Sleep(100 * time.Millisecond)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+	handshake := func(decorder Decorder, host, serverName string) (state tls.ConnectionState, err error) {
+		a, b := net.Pipe()
+		defer a.Close()
+		a.SetDeadline(time.Now().Add(time.Second)) //the alert of bad certificate may be blocked on pipe
+		conn, err := decorder.Decord(host, b)
+		if err != nil {
+			return
+		}
+		go conn.(*tls.Conn).Handshake()
+		client := tls.Client(a, &tls.Config{RootCAs: pool, ServerName: serverName})
+		err = client.Handshake()
+		state = client.ConnectionState()
+		return
+	}
+	decorder := NewTLSDecorder()
+	decorder.Server = "http://127.0.0.1:10061/cert?host=%v"
+	//multi host on one decorder
+	state, err := handshake(decorder, "a.snows.io:443", "a.snows.io")
+	if err != nil || state.PeerCertificates[0].DNSNames[0] != "a.snows.io" {
+		t.Errorf("err:%v", err)
+		return
+	}
+	state, err = handshake(decorder, "b.snows.io:443", "b.snows.io")
+	if err != nil || state.PeerCertificates[0].DNSNames[0] != "b.snows.io" {
+		t.Errorf("err:%v", err)
+		return
+	}
+	//sni is same as host
+	state, err = handshake(decorder, "A.snows.io:443", "a.snows.io")
+	if err != nil || state.PeerCertificates[0].DNSNames[0] != "a.snows.io" {
+		t.Errorf("err:%v", err)
+		return
+	}
+	//sni not matched is not loaded
+	_, err = handshake(decorder, "a.snows.io:443", "c.snows.io")
+	if err == nil || decorder.certs["c.snows.io:443"] != nil || decorder.fails["c.snows.io:443"] != nil {
+		t.Errorf("err:%v", err)
+		return
+	}
+	//cached
+	os.Remove(certFileA)
+	state, err = handshake(decorder, "a.snows.io:443", "a.snows.io")
+	if err != nil || state.PeerCertificates[0].SerialNumber.Cmp(certA.Leaf.SerialNumber) != 0 {
+		t.Errorf("err:%v", err)
+		return
+	}
+	//expired
+	certA2, _ := ca.Issue("a.snows.io")
+	writeTestCert(dir, "a", certA2)
+	decorder.certs["a.snows.io:443"].Leaf.NotAfter = time.Now().Add(-time.Second)
+	state, err = handshake(decorder, "a.snows.io:443", "a.snows.io")
+	if err != nil || state.PeerCertificates[0].SerialNumber.Cmp(certA2.Leaf.SerialNumber) != 0 {
+		t.Errorf("err:%v", err)
+		return
+	}
+	//error
+	_, err = handshake(decorder, "c.snows.io:443", "c.snows.io")
+	if err == nil || decorder.fails["c.snows.io:443"] == nil {
+		t.Error("error")
+		return
+	}
+	//fail cached
+	center.certsLck.Lock()
+	center.certs = append(center.certs, map[string]interface{}{"host": "c.snows.io:443", "cert": certFileB, "key": keyFileB})
+	center.certsLck.Unlock()
+	_, err = decorder.certificate("c.snows.io:443")
+	if err == nil {
+		t.Error("error")
+		return
+	}
+	decorder.fails["c.snows.io:443"].until = time.Now()
+	_, err = decorder.certificate("c.snows.io:443")
+	if err != nil || decorder.fails["c.snows.io:443"] != nil {
+		t.Errorf("err:%v", err)
+		return
+	}
+	//max certs
+	decorder.MaxCerts = 2
+	delete(decorder.certs, "b.snows.io:443")
+	decorder.certificate("a.snows.io:443")
+	decorder.certificate("b.snows.io:443")
+	if len(decorder.certs) != 2 || decorder.certs["c.snows.io:443"] != nil || decorder.certs["a.snows.io:443"] == nil {
+		t.Errorf("certs:%v", len(decorder.certs))
+		return
+	}
+	//static cert
+	decorder2 := NewTLSDecorder()
+	decorder2.Cert, decorder2.Key = certFileB, keyFileB
+	state, err = handshake(decorder2, "x.snows.io:443", "b.snows.io")
+	if err != nil || state.PeerCertificates[0].DNSNames[0] != "b.snows.io" {
+		t.Errorf("err:%v", err)
+		return
+	}
+}
+
+func TestTLSDecorderRefresh(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wdebugger")
+	defer os.RemoveAll(dir)
+	ca, _ := GenerateCA("test")
+	cert1, _ := ca.Issue("a.snows.io")
+	certFile, keyFile := writeTestCert(dir, "a", cert1)
+	center := NewTLSCertCenter(map[string]interface{}{"host": "a.snows.io:443", "cert": certFile, "key": keyFile})
+	center.MaxAge = 0
+	go http.ListenAndServe(":10062", center)
+	time.Sleep(100 * time.Millisecond)
+	//etag
+	status, header, _, err := httpGetHeader(nil, "http://127.0.0.1:10062/cert?host=a.snows.io:443", "", "", nil)
+	if err != nil || status != 200 || len(header.Get("ETag")) < 1 || header.Get("Cache-Control") != "no-cache" {
+		t.Errorf("err:%v,status:%v,header:%v", err, status, header)
+		return
+	}
+	status, _, _, err = httpGetHeader(nil, "http://127.0.0.1:10062/cert?host=a.snows.io:443", "", "", http.Header{"If-None-Match": {header.Get("ETag")}})
+	if err != nil || status != 304 {
+		t.Errorf("err:%v,status:%v", err, status)
+		return
+	}
+	//refresh
+	expiring := make(chan string, 10)
+	decorder := NewTLSDecorder()
+	decorder.Server = "http://127.0.0.1:10062/cert?host=%v"
+	decorder.CheckInterval = 50 * time.Millisecond
+	decorder.RefreshInterval = 50 * time.Millisecond
+	decorder.WarnBefore = 2 * 365 * 24 * time.Hour
+	decorder.OnExpiring = func(host string, leaf *x509.Certificate) {
+		expiring <- host
+	}
+	defer decorder.Close()
+	cert, err := decorder.certificate("a.snows.io:443")
+	if err != nil || cert.Leaf.SerialNumber.Cmp(cert1.Leaf.SerialNumber) != 0 {
+		t.Errorf("err:%v", err)
+		return
+	}
+	time.Sleep(200 * time.Millisecond)
+	cert, _ = decorder.certificate("a.snows.io:443")
+	if cert.Leaf.SerialNumber.Cmp(cert1.Leaf.SerialNumber) != 0 {
+		t.Error("error")
+		return
+	}
+	cert2, _ := ca.Issue("a.snows.io")
+	writeTestCert(dir, "a", cert2)
+	time.Sleep(200 * time.Millisecond)
+	cert, _ = decorder.certificate("a.snows.io:443")
+	if cert.Leaf.SerialNumber.Cmp(cert2.Leaf.SerialNumber) != 0 {
+		t.Error("error")
+		return
+	}
+	//warn once for each certificate
+	if len(expiring) != 2 {
+		t.Errorf("expiring:%v", len(expiring))
+		return
+	}
+	//refresh before expired
+	decorder2 := NewTLSDecorder()
+	decorder2.Server = "http://127.0.0.1:10062/cert?host=%v"
+	decorder2.RefreshBefore = 2 * 365 * 24 * time.Hour
+	decorder2.RefreshInterval = 0
+	decorder2.certificate("a.snows.io:443")
+	if decorder2.certs["a.snows.io:443"].next.After(time.Now()) {
+		t.Error("error")
+		return
+	}
+}
+
+func TestTLSCertCenterClientAuth(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wdebugger")
+	defer os.RemoveAll(dir)
+	ca, _ := GenerateCA("test")
+	caFile := filepath.Join(dir, "ca.crt")
+	ca.Save(caFile, filepath.Join(dir, "ca.key"))
+	serverCert, _ := ca.Issue("127.0.0.1")
+	serverCertFile, serverKeyFile := writeTestCert(dir, "server", serverCert)
+	clientA, _ := ca.IssueClient("proxy-a")
+	clientCertA, clientKeyA := writeTestCert(dir, "proxy-a", clientA)
+	clientB, _ := ca.IssueClient("proxy-b")
+	clientCertB, clientKeyB := writeTestCert(dir, "proxy-b", clientB)
+	certA, _ := ca.Issue("a.snows.io")
+	certFileA, keyFileA := writeTestCert(dir, "a", certA)
+	center := NewTLSCertCenter(
+		map[string]interface{}{"host": "a.snows.io:443", "cert": certFileA, "key": keyFileA, "clients": []interface{}{"proxy-a"}},
+		map[string]interface{}{"host": "b.snows.io:443", "cert": certFileA, "key": keyFileA},
+	)
+	config, err := NewClientAuthTLSConfig(caFile)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	server := &http.Server{Addr: ":10063", Handler: center, TLSConfig: config}
+	go server.ListenAndServeTLS(serverCertFile, serverKeyFile)
+	time.Sleep(100 * time.Millisecond)
+	newDecorder := func(clientCert, clientKey, serverCA string) *TLSDecorder {
+		decorder := NewTLSDecorder()
+		decorder.Server = "https://127.0.0.1:10063/cert?host=%v"
+		decorder.ClientCert, decorder.ClientKey, decorder.ServerCA = clientCert, clientKey, serverCA
+		return decorder
+	}
+	//allowed
+	_, err = newDecorder(clientCertA, clientKeyA, caFile).certificate("a.snows.io:443")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	//not limited by clients
+	_, err = newDecorder(clientCertB, clientKeyB, caFile).certificate("b.snows.io:443")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	//not allowed
+	_, err = newDecorder(clientCertB, clientKeyB, caFile).certificate("a.snows.io:443")
+	if err == nil {
+		t.Error("error")
+		return
+	}
+	//not client cert
+	_, err = newDecorder("", "", caFile).certificate("b.snows.io:443")
+	if err == nil {
+		t.Error("error")
+		return
+	}
+	//server is not pinned CA
+	other, _ := GenerateCA("other")
+	otherFile := filepath.Join(dir, "other.crt")
+	other.Save(otherFile, filepath.Join(dir, "other.key"))
+	_, err = newDecorder(clientCertA, clientKeyA, otherFile).certificate("a.snows.io:443")
+	if err == nil {
+		t.Error("error")
+		return
+	}
+	//load error
+	_, err = newDecorder("xx.crt", "xx.key", "").certificate("a.snows.io:443")
+	if err == nil {
+		t.Error("error")
+		return
+	}
+	_, err = newDecorder("", "", "xx.crt").certificate("a.snows.io:443")
+	if err == nil {
+		t.Error("error")
+		return
+	}
+	//not tls request
+	if matchClient([]string{"proxy-a"}, &http.Request{}) {
+		t.Error("error")
+		return
+	}
+	if _, err = NewClientAuthTLSConfig("xx.crt"); err == nil {
+		t.Error("error")
+		return
+	}
+}
+
+func TestTLSCertCenterToken(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wdebugger")
+	defer os.RemoveAll(dir)
+	ca, _ := GenerateCA("test")
+	certA, _ := ca.Issue("a.snows.io")
+	certFileA, keyFileA := writeTestCert(dir, "a", certA)
+	password, _ := HashPassword(HashBcrypt, "123")
+	center := NewTLSCertCenter(
+		map[string]interface{}{"host": "a.snows.io:443", "cert": certFileA, "key": keyFileA, "username": "abc", "password": password},
+		map[string]interface{}{"host": "b.snows.io:443", "cert": certFileA, "key": keyFileA, "username": "abc", "password": password},
+	)
+	tokenA, _ := NewToken()
+	tokenHash := HashToken(tokenA)
+	center.Tokens = []*AuthToken{{Name: "a", Token: tokenHash, Scopes: []string{"cert:a.snows.io:443"}}}
+	go http.ListenAndServe(":10064", center)
+	time.Sleep(100 * time.Millisecond)
+	newDecorder := func(username, password, token string) *TLSDecorder {
+		decorder := NewTLSDecorder()
+		decorder.Server = "http://127.0.0.1:10064/cert?host=%v"
+		decorder.Username, decorder.Password, decorder.Token = username, password, token
+		return decorder
+	}
+	//basic auth by bcrypt
+	if _, err := newDecorder("abc", "123", "").certificate("a.snows.io:443"); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := newDecorder("abc", "1234", "").certificate("a.snows.io:443"); err == nil {
+		t.Error("error")
+		return
+	}
+	if _, err := newDecorder("abcd", "123", "").certificate("a.snows.io:443"); err == nil {
+		t.Error("error")
+		return
+	}
+	//token
+	if _, err := newDecorder("", "", tokenA).certificate("a.snows.io:443"); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := newDecorder("", "", tokenA).certificate("b.snows.io:443"); err == nil {
+		t.Error("error")
+		return
+	}
+	if _, err := newDecorder("", "", "xx").certificate("a.snows.io:443"); err == nil {
+		t.Error("error")
+		return
+	}
+}
+
+func TestTLSCertCenterKeyWrap(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wdebugger")
+	defer os.RemoveAll(dir)
+	ca, _ := GenerateCA("test")
+	certA, _ := ca.Issue("a.snows.io")
+	certFileA, keyFileA := writeTestCert(dir, "a", certA)
+	center := NewTLSCertCenter(
+		map[string]interface{}{"host": "a.snows.io:443", "cert": certFileA, "key": keyFileA, "psk": "123"},
+		map[string]interface{}{"host": "b.snows.io:443", "cert": certFileA, "key": keyFileA},
+	)
+	go http.ListenAndServe(":10065", center)
+	time.Sleep(100 * time.Millisecond)
+	newDecorder := func(psk string, wrapKey bool) *TLSDecorder {
+		decorder := NewTLSDecorder()
+		decorder.Server = "http://127.0.0.1:10065/cert?host=%v"
+		decorder.PSK, decorder.WrapKey = psk, wrapKey
+		return decorder
+	}
+	//raw key is not in response
+	_, _, data, _ := httpGetHeader(nil, "http://127.0.0.1:10065/cert?host=a.snows.io:443", "", "", nil)
+	if bytes.Contains(data, []byte(`"key"`)) || !bytes.Contains(data, []byte(KeyWrapPSK)) {
+		t.Errorf("data:%v", string(data))
+		return
+	}
+	//psk
+	if _, err := newDecorder("123", false).certificate("a.snows.io:443"); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := newDecorder("1234", false).certificate("a.snows.io:443"); err == nil {
+		t.Error("error")
+		return
+	}
+	if _, err := newDecorder("", false).certificate("a.snows.io:443"); err == nil {
+		t.Error("error")
+		return
+	}
+	//x25519
+	if _, err := newDecorder("", true).certificate("b.snows.io:443"); err != nil {
+		t.Error(err)
+		return
+	}
+	//raw
+	if _, err := newDecorder("", false).certificate("b.snows.io:443"); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := newDecorder("123", false).certificate("b.snows.io:443"); err == nil {
+		t.Error("error")
+		return
+	}
+	//require wrap
+	center.RequireWrap = true
+	if _, err := newDecorder("", false).certificate("b.snows.io:443"); err == nil {
+		t.Error("error")
+		return
+	}
+	if _, err := newDecorder("", true).certificate("b.snows.io:443"); err != nil {
+		t.Error(err)
+		return
+	}
+	//invalid public key
+	status, _, _, _ := httpGetHeader(nil, "http://127.0.0.1:10065/cert?host=b.snows.io:443", "", "", http.Header{KeyWrapHeader: {"xx"}})
+	if status != 400 {
+		t.Errorf("status:%v", status)
+		return
+	}
+}
@@ -0,0 +1,229 @@
+package webdebugger
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+//the level of ConfigHost.DumpBody
+//
+//  DumpBodyNone   not dump body
+//  DumpBodyText   dump the textual body only, the binary body is dumped as size
+//  DumpBodyBinary dump the textual body and hex dump the binary body
+const (
+	DumpBodyNone   = 0
+	DumpBodyText   = 1
+	DumpBodyBinary = 2
+)
+
+//DefaultDumpLimit is the default max bytes of body to dump
+const DefaultDumpLimit = 4096
+
+//maxDumpForm is the max bytes of urlencoded request body to parse form
+const maxDumpForm = 10 * 1024 * 1024
+
+//httpDumper will dump the request/response which is forwarded by httputil.ReverseProxy by ConfigHost dump level,
+//it is used as ReverseProxy.Transport and ReverseProxy.ModifyResponse
+type httpDumper struct {
+	Host      *ConfigHost
+	Origin    string
+	Transport http.RoundTripper
+}
+
+func (h *httpDumper) limit() int {
+	if h.Host.DumpLimit > 0 {
+		return h.Host.DumpLimit
+	}
+	return DefaultDumpLimit
+}
+
+//RoundTrip will dump the request after the body is sent, or dump it directly when body is not dumped
+func (h *httpDumper) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	if h.Host.DumpRequest < 1 {
+		resp, err = h.Transport.RoundTrip(req)
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	err = h.dumpRequest(buf, req)
+	if err != nil {
+		WarnLog("Debuger read body of %v fail with %v", req.URL, err)
+		return
+	}
+	if h.Host.DumpBody == DumpBodyNone || req.Body == nil || req.Body == http.NoBody {
+		InfoLog("Debuger dump request:\n%v\n\n", buf.String())
+		resp, err = h.Transport.RoundTrip(req)
+		return
+	}
+	req.Body = newDumpReader(req.Body, h.limit(), func(body []byte, size int64) {
+		fmt.Fprintln(buf, "\n---Body---")
+		h.dumpBody(buf, req.Header, body, size)
+		InfoLog("Debuger dump request:\n%v\n\n", buf.String())
+	})
+	resp, err = h.Transport.RoundTrip(req)
+	return
+}
+
+//dumpRequest will dump the request to buf, it return error only when the urlencoded body is read fail
+func (h *httpDumper) dumpRequest(buf *bytes.Buffer, req *http.Request) (err error) {
+	fmt.Fprintln(buf, "---URL---")
+	fmt.Fprintln(buf, "Method\t", req.Method)
+	fmt.Fprintln(buf, "Host\t", h.Origin)
+	fmt.Fprintln(buf, "Path\t", req.URL.Path)
+	fmt.Fprintln(buf, "RawPath\t", req.URL.RawPath)
+	fmt.Fprintln(buf, "RawQuery\t", req.URL.RawQuery)
+	fmt.Fprintln(buf, "User\t", req.URL.User)
+	//
+	fmt.Fprintln(buf, "\n---Header---")
+	dumpHeader(buf, req.Header)
+	//
+	form, err := parseDumpForm(req)
+	if form == nil {
+		return
+	}
+	if err != nil {
+		WarnLog("Debuger parse form of %v fail with %v", req.URL, err)
+		err = nil
+		return
+	}
+	fmt.Fprintln(buf, "\n---Form---")
+	for k, v := range form.Form {
+		fmt.Fprintln(buf, k, "\t", v)
+	}
+	//
+	fmt.Fprintln(buf, "\n---PostForm---")
+	for k, v := range form.PostForm {
+		fmt.Fprintln(buf, k, "\t", v)
+	}
+	return
+}
+
+//ModifyResponse will dump the response after the body is received, or dump it directly when body is not dumped
+func (h *httpDumper) ModifyResponse(resp *http.Response) (err error) {
+	if h.Host.DumpResponse < 1 {
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintln(buf, "---Response---")
+	fmt.Fprintln(buf, "Request\t", resp.Request.Method, h.Origin+resp.Request.URL.RequestURI())
+	fmt.Fprintln(buf, "Status\t", resp.Status)
+	fmt.Fprintln(buf, "Proto\t", resp.Proto)
+	//
+	fmt.Fprintln(buf, "\n---Header---")
+	dumpHeader(buf, resp.Header)
+	if h.Host.DumpBody == DumpBodyNone || resp.Body == nil || resp.Body == http.NoBody {
+		InfoLog("Debuger dump response:\n%v\n\n", buf.String())
+		return
+	}
+	resp.Body = newDumpReader(resp.Body, h.limit(), func(body []byte, size int64) {
+		fmt.Fprintln(buf, "\n---Body---")
+		h.dumpBody(buf, resp.Header, body, size)
+		InfoLog("Debuger dump response:\n%v\n\n", buf.String())
+	})
+	return
+}
+
+//dumpBody will dump the decompressed body by content type and dump level
+func (h *httpDumper) dumpBody(buf *bytes.Buffer, header http.Header, body []byte, size int64) {
+	truncated := size > int64(len(body))
+	decoded, err := decodeBody(header, body)
+	if err != nil && len(decoded) < 1 {
+		fmt.Fprintf(buf, "<%v bytes %v body, decompress fail with %v>\n", size, header.Get("Content-Encoding"), err)
+		return
+	}
+	contentType := header.Get("Content-Type")
+	if len(decoded) > h.limit() {
+		decoded, truncated = decoded[:h.limit()], true
+	}
+	switch {
+	case isTextType(contentType) || (len(contentType) < 1 && utf8.Valid(decoded)):
+		buf.Write(decoded)
+		fmt.Fprintln(buf)
+	case h.Host.DumpBody >= DumpBodyBinary:
+		buf.WriteString(hex.Dump(decoded))
+	default:
+		fmt.Fprintf(buf, "<%v bytes %v body>\n", size, contentType)
+		return
+	}
+	if truncated {
+		fmt.Fprintf(buf, "<truncated, total %v bytes>\n", size)
+	}
+}
+
+func dumpHeader(buf *bytes.Buffer, header http.Header) {
+	for k, v := range header {
+		fmt.Fprintln(buf, k, "\t", v)
+	}
+}
+
+//parseDumpForm will parse the form of request by ParseForm without consuming the request body,
+//the form is nil when the urlencoded body is read fail, the request should not be forwarded with the partial body
+func parseDumpForm(req *http.Request) (form *http.Request, err error) {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	var body io.ReadCloser
+	if mediaType == "application/x-www-form-urlencoded" && req.Body != nil && req.Body != http.NoBody &&
+		req.ContentLength >= 0 && req.ContentLength <= maxDumpForm {
+		var data []byte
+		data, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(data))
+		body = ioutil.NopCloser(bytes.NewReader(data))
+	}
+	form = &http.Request{Method: req.Method, URL: req.URL, Header: req.Header, Body: body}
+	err = form.ParseForm()
+	return
+}
+
+//isTextType will check the content type is textual
+func isTextType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml") || strings.HasSuffix(mediaType, "javascript") ||
+		mediaType == "application/x-www-form-urlencoded"
+}
+
+//dumpReader is the body wrapper to keep the limited body, the done is called once when body is read to end or closed
+type dumpReader struct {
+	io.ReadCloser
+	limit int
+	body  []byte
+	size  int64
+	done  func(body []byte, size int64)
+	once  sync.Once
+}
+
+func newDumpReader(body io.ReadCloser, limit int, done func(body []byte, size int64)) (reader *dumpReader) {
+	reader = &dumpReader{ReadCloser: body, limit: limit, done: done}
+	return
+}
+
+func (d *dumpReader) Read(p []byte) (n int, err error) {
+	n, err = d.ReadCloser.Read(p)
+	d.size += int64(n)
+	if remain := d.limit - len(d.body); remain > 0 {
+		if remain > n {
+			remain = n
+		}
+		d.body = append(d.body, p[:remain]...)
+	}
+	if err != nil {
+		d.once.Do(func() { d.done(d.body, d.size) })
+	}
+	return
+}
+
+func (d *dumpReader) Close() (err error) {
+	err = d.ReadCloser.Close()
+	d.once.Do(func() { d.done(d.body, d.size) })
+	return
+}
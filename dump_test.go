@@ -0,0 +1,128 @@
+package webdebugger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestHTTPDumper(t *testing.T) {
+	SetLogLevel(LogLevelDebug)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/gzip":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "gzip")
+			writer := gzip.NewWriter(w)
+			fmt.Fprintf(writer, `{"a":"%v"}`, r.PostForm.Get("a"))
+			writer.Close()
+		case "/binary":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte{0x00, 0x01, 0x02, 0xff})
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprintf(w, "%v", strings.Repeat("x", 100))
+		}
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+	dump := func(host *ConfigHost, method, path, contentType, body string) (resp, logs string) {
+		out := bytes.NewBuffer(nil)
+		log.SetOutput(out)
+		defer log.SetOutput(os.Stderr)
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		dumper := &httpDumper{Host: host, Origin: "a.snows.io", Transport: http.DefaultTransport}
+		proxy.Transport = dumper
+		proxy.ModifyResponse = dumper.ModifyResponse
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if len(contentType) > 0 {
+			req.Header.Set("Content-Type", contentType)
+		}
+		recorder := httptest.NewRecorder()
+		proxy.ServeHTTP(recorder, req)
+		resp, logs = recorder.Body.String(), out.String()
+		return
+	}
+	//form and gzip json
+	host := &ConfigHost{DumpRequest: 1, DumpResponse: 1, DumpBody: DumpBodyText}
+	_, logs := dump(host, "POST", "/gzip?b=2", "application/x-www-form-urlencoded", "a=1")
+	for _, expect := range []string{"a.snows.io", "PostForm---\na \t [1]", "b \t [2]", "a=1\n", `{"a":"1"}`, "200 OK"} {
+		if !strings.Contains(logs, expect) {
+			t.Errorf("expect:%v,logs:%v", expect, logs)
+			return
+		}
+	}
+	//binary and limit
+	_, logs = dump(host, "GET", "/binary", "", "")
+	if !strings.Contains(logs, "<4 bytes application/octet-stream body>") {
+		t.Errorf("logs:%v", logs)
+		return
+	}
+	host = &ConfigHost{DumpResponse: 1, DumpBody: DumpBodyBinary, DumpLimit: 10}
+	_, logs = dump(host, "GET", "/binary", "", "")
+	if !strings.Contains(logs, "00 01 02 ff") || strings.Contains(logs, "---URL---") {
+		t.Errorf("logs:%v", logs)
+		return
+	}
+	resp, logs := dump(host, "GET", "/text", "", "")
+	if len(resp) != 100 || !strings.Contains(logs, strings.Repeat("x", 10)+"\n<truncated, total 100 bytes>") {
+		t.Errorf("logs:%v", logs)
+		return
+	}
+	//no body
+	host = &ConfigHost{DumpRequest: 1}
+	resp, logs = dump(host, "POST", "/text", "text/plain", "abc")
+	if len(resp) != 100 || !strings.Contains(logs, "---URL---") || strings.Contains(logs, "---Response---") {
+		t.Errorf("logs:%v", logs)
+		return
+	}
+	//invalid
+	host = &ConfigHost{DumpRequest: 1, DumpResponse: 1, DumpBody: DumpBodyText}
+	_, logs = dump(host, "POST", "/text?%zz", "application/x-www-form-urlencoded", "a=1")
+	if !strings.Contains(logs, "parse form") {
+		t.Errorf("logs:%v", logs)
+		return
+	}
+	//body read fail
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = &httpDumper{Host: host, Origin: "a.snows.io", Transport: http.DefaultTransport}
+	req := httptest.NewRequest("POST", "/text", io.MultiReader(strings.NewReader("a=1"), iotest.ErrReader(fmt.Errorf("test error"))))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.ContentLength = 3
+	recorder := httptest.NewRecorder()
+	proxy.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusBadGateway {
+		t.Errorf("code:%v", recorder.Code)
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	header := http.Header{}
+	header.Set("Content-Encoding", "gzip")
+	dumper := &httpDumper{Host: host}
+	dumper.dumpBody(buf, header, []byte("abc"), 3)
+	if !strings.Contains(buf.String(), "decompress fail") {
+		t.Errorf("dump:%v", buf.String())
+		return
+	}
+	data, _ := ioutil.ReadAll(newDumpReader(ioutil.NopCloser(strings.NewReader("abc")), 2, func(body []byte, size int64) {
+		if string(body) != "ab" || size != 3 {
+			t.Errorf("body:%v,size:%v", string(body), size)
+		}
+	}))
+	if string(data) != "abc" {
+		t.Error("error")
+		return
+	}
+}
@@ -0,0 +1,246 @@
+package webdebugger
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode/utf8"
+)
+
+//HAR is pojo to HTTP Archive 1.2, see http://www.softwareishard.com/blog/har-12-spec/
+type HAR struct {
+	Log *HARLog `json:"log"`
+}
+
+//HARLog is pojo to HAR log
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator *HARCreator `json:"creator"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+//HARCreator is pojo to HAR creator
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+//HAREntry is pojo to HAR entry, the custom field is started with _
+type HAREntry struct {
+	StartedDateTime string                 `json:"startedDateTime"`
+	Time            float64                `json:"time"`
+	Request         *HARRequest            `json:"request"`
+	Response        *HARResponse           `json:"response"`
+	Cache           map[string]interface{} `json:"cache"`
+	Timings         *HARTimings            `json:"timings"`
+	Connection      string                 `json:"connection,omitempty"`
+	ID              uint64                 `json:"_id"`
+	Host            *ConfigHost            `json:"_host,omitempty"`
+	TLS             *CaptureTLS            `json:"_tls,omitempty"`
+	Error           string                 `json:"_error,omitempty"`
+	ReplayOf        uint64                 `json:"_replay_of,omitempty"`
+}
+
+//HARNameValue is pojo to HAR header/query/cookie
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+//HARRequest is pojo to HAR request
+type HARRequest struct {
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []*HARNameValue `json:"cookies"`
+	Headers     []*HARNameValue `json:"headers"`
+	QueryString []*HARNameValue `json:"queryString"`
+	PostData    *HARPostData    `json:"postData,omitempty"`
+	HeadersSize int64           `json:"headersSize"`
+	BodySize    int64           `json:"bodySize"`
+}
+
+//HARPostData is pojo to HAR request post data
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"_encoding,omitempty"`
+}
+
+//HARResponse is pojo to HAR response
+type HARResponse struct {
+	Status      int             `json:"status"`
+	StatusText  string          `json:"statusText"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []*HARNameValue `json:"cookies"`
+	Headers     []*HARNameValue `json:"headers"`
+	Content     *HARContent     `json:"content"`
+	RedirectURL string          `json:"redirectURL"`
+	HeadersSize int64           `json:"headersSize"`
+	BodySize    int64           `json:"bodySize"`
+}
+
+//HARContent is pojo to HAR response content, the Text is decompressed and base64 encoded when it is not utf8
+type HARContent struct {
+	Size        int64  `json:"size"`
+	Compression int64  `json:"compression,omitempty"`
+	MimeType    string `json:"mimeType"`
+	Text        string `json:"text,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+}
+
+//HARTimings is pojo to HAR timings in milliseconds, the unknown timing is -1
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+//NewHAR will create HAR by captured exchange
+func NewHAR(entries []*CaptureEntry) (har *HAR) {
+	har = &HAR{
+		Log: &HARLog{
+			Version: "1.2",
+			Creator: &HARCreator{Name: "webdebugger", Version: "1.0.0"},
+			Entries: []*HAREntry{},
+		},
+	}
+	for _, entry := range entries {
+		har.Log.Entries = append(har.Log.Entries, entry.HAR())
+	}
+	return
+}
+
+//WriteHAR will write captured exchange as HAR json to writer
+func WriteHAR(w io.Writer, entries []*CaptureEntry) (err error) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(NewHAR(entries))
+	return
+}
+
+//HAR will convert captured exchange to HAR entry
+func (c *CaptureEntry) HAR() (entry *HAREntry) {
+	entry = &HAREntry{
+		StartedDateTime: c.Started.Format(time.RFC3339Nano),
+		Time:            harMillis(c.Timings.Total()),
+		Request:         c.Request.harRequest(),
+		Response:        c.Response.harResponse(),
+		Cache:           map[string]interface{}{},
+		Timings: &HARTimings{
+			Blocked: -1,
+			DNS:     -1,
+			Connect: -1,
+			Send:    harMillis(c.Timings.Send),
+			Wait:    harMillis(c.Timings.Wait),
+			Receive: harMillis(c.Timings.Receive),
+			SSL:     -1,
+		},
+		Connection: c.Remote,
+		ID:         c.ID,
+		Host:       c.Host,
+		TLS:        c.TLS,
+		Error:      c.Error,
+		ReplayOf:   c.ReplayOf,
+	}
+	return
+}
+
+func (c *CaptureMessage) harRequest() (request *HARRequest) {
+	request = &HARRequest{
+		Method:      c.Method,
+		URL:         c.URL,
+		HTTPVersion: c.Proto,
+		Cookies:     harCookies((&http.Request{Header: c.Header}).Cookies()),
+		Headers:     harHeaders(c.Header),
+		QueryString: []*HARNameValue{},
+		HeadersSize: -1,
+		BodySize:    c.BodySize,
+	}
+	if u, err := url.Parse(c.URL); err == nil {
+		for key, vals := range u.Query() {
+			for _, val := range vals {
+				request.QueryString = append(request.QueryString, &HARNameValue{Name: key, Value: val})
+			}
+		}
+	}
+	if c.BodySize > 0 {
+		text, encoding := harText(c.Body)
+		request.PostData = &HARPostData{
+			MimeType: c.Header.Get("Content-Type"),
+			Text:     text,
+			Encoding: encoding,
+		}
+	}
+	return
+}
+
+func (c *CaptureMessage) harResponse() (response *HARResponse) {
+	response = &HARResponse{
+		Status:      c.Status,
+		StatusText:  http.StatusText(c.Status),
+		HTTPVersion: c.Proto,
+		Cookies:     harCookies((&http.Response{Header: c.Header}).Cookies()),
+		Headers:     harHeaders(c.Header),
+		Content: &HARContent{
+			Size:     c.BodySize,
+			MimeType: c.Header.Get("Content-Type"),
+		},
+		RedirectURL: c.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    c.BodySize,
+	}
+	if len(c.Body) < 1 {
+		return
+	}
+	body := c.Body
+	if !c.Truncated {
+		decoded, err := decodeBody(c.Header, c.Body)
+		if err == nil {
+			body = decoded
+			response.Content.Size = int64(len(decoded))
+			response.Content.Compression = response.Content.Size - c.BodySize
+		}
+	}
+	response.Content.Text, response.Content.Encoding = harText(body)
+	return
+}
+
+//harText will return the body as text when it is utf8, or base64 encoded
+func harText(body []byte) (text, encoding string) {
+	if utf8.Valid(body) {
+		text = string(body)
+		return
+	}
+	text, encoding = base64.StdEncoding.EncodeToString(body), "base64"
+	return
+}
+
+func harHeaders(header http.Header) (headers []*HARNameValue) {
+	headers = []*HARNameValue{}
+	for key, vals := range header {
+		for _, val := range vals {
+			headers = append(headers, &HARNameValue{Name: key, Value: val})
+		}
+	}
+	return
+}
+
+func harCookies(cookies []*http.Cookie) (values []*HARNameValue) {
+	values = []*HARNameValue{}
+	for _, cookie := range cookies {
+		values = append(values, &HARNameValue{Name: cookie.Name, Value: cookie.Value})
+	}
+	return
+}
+
+func harMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,64 @@
+package webdebugger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHAR(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	writer := gzip.NewWriter(buf)
+	writer.Write([]byte(`{"a":1}`))
+	writer.Close()
+	entry := &CaptureEntry{
+		ID:      1,
+		Started: time.Now(),
+		Remote:  "a.snows.io:443",
+		TLS:     &CaptureTLS{Version: "TLS 1.3"},
+		Request: &CaptureMessage{
+			Method:   "POST",
+			URL:      "https://a.snows.io/abc?a=1",
+			Proto:    "HTTP/1.1",
+			Header:   http.Header{"Cookie": {"x=1"}, "Content-Type": {"application/octet-stream"}},
+			Body:     []byte{0xff, 0xfe},
+			BodySize: 2,
+		},
+		Response: &CaptureMessage{
+			Status:   200,
+			Proto:    "HTTP/1.1",
+			Header:   http.Header{"Set-Cookie": {"y=2"}, "Content-Encoding": {"gzip"}, "Content-Type": {"application/json"}},
+			Body:     buf.Bytes(),
+			BodySize: int64(buf.Len()),
+		},
+		Timings: CaptureTimings{Send: time.Millisecond, Wait: 2 * time.Millisecond, Receive: time.Millisecond},
+	}
+	out := bytes.NewBuffer(nil)
+	err := WriteHAR(out, []*CaptureEntry{entry, {Request: &CaptureMessage{}, Response: &CaptureMessage{}}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	har := &HAR{}
+	err = json.Unmarshal(out.Bytes(), har)
+	if err != nil || har.Log.Version != "1.2" || len(har.Log.Entries) != 2 {
+		t.Errorf("err:%v,har:%v", err, out.String())
+		return
+	}
+	e := har.Log.Entries[0]
+	if e.Time != 4 || e.Timings.Wait != 2 || e.TLS.Version != "TLS 1.3" {
+		t.Errorf("entry:%v", e)
+		return
+	}
+	if len(e.Request.QueryString) != 1 || len(e.Request.Cookies) != 1 || e.Request.PostData.Encoding != "base64" {
+		t.Errorf("request:%v", e.Request)
+		return
+	}
+	if e.Response.Content.Text != `{"a":1}` || e.Response.Content.Size != 7 || len(e.Response.Cookies) != 1 {
+		t.Errorf("response:%v", e.Response.Content)
+		return
+	}
+}
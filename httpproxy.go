@@ -0,0 +1,198 @@
+package webdebugger
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+//HTTPProxy is an implementation of http proxy, it supported CONNECT and absolute-URI request,
+//the request is authorized by Proxy-Authorization basic auth when Username is setted
+type HTTPProxy struct {
+	net.Listener
+	Username string
+	Password string
+	ProcConn func(uri string, raw net.Conn) (async bool, err error)
+}
+
+//NewHTTPProxy will return new HTTPProxy
+func NewHTTPProxy() (proxy *HTTPProxy) {
+	proxy = &HTTPProxy{}
+	return
+}
+
+//Listen the address
+func (h *HTTPProxy) Listen(addr string) (err error) {
+	h.Listener, err = net.Listen("tcp", addr)
+	if err == nil {
+		InfoLog("HTTPProxy listen http proxy on %v", addr)
+	}
+	return
+}
+
+//Run proxy listener
+func (h *HTTPProxy) Run() (err error) {
+	if h.Listener != nil {
+		h.loopAccept(h.Listener)
+	}
+	return
+}
+
+func (h *HTTPProxy) loopAccept(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			break
+		}
+		go h.procConn(conn)
+	}
+}
+
+func (h *HTTPProxy) procConn(conn net.Conn) {
+	h.procReader(bufio.NewReader(conn), conn)
+}
+
+//procReader will proc http proxy request on conn, the reader is the buffered reader of conn
+func (h *HTTPProxy) procReader(reader *bufio.Reader, conn net.Conn) {
+	var err error
+	var async bool
+	DebugLog("HTTPProxy proxy connection from %v", conn.RemoteAddr())
+	defer func() {
+		if !async {
+			DebugLog("HTTPProxy proxy connection from %v is done with %v", conn.RemoteAddr(), err)
+			conn.Close()
+		}
+	}()
+	for {
+		var req *http.Request
+		req, err = http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		if !h.auth(req) {
+			fmt.Fprintf(conn, "HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: Basic realm=\"Web Debugger\"\r\n"+
+				"Content-Length: 0\r\nConnection: close\r\n\r\n")
+			err = fmt.Errorf("proxy auth fail on %v", req.Host)
+			return
+		}
+		if req.Method == http.MethodConnect {
+			async, err = h.procConnect(req, reader, conn)
+			return
+		}
+		var keep bool
+		keep, err = h.procForward(req, conn)
+		if err != nil || !keep {
+			return
+		}
+	}
+}
+
+//auth will check the Proxy-Authorization basic auth when Username is setted
+func (h *HTTPProxy) auth(req *http.Request) bool {
+	if len(h.Username) < 1 {
+		return true
+	}
+	auth := req.Header.Get("Proxy-Authorization")
+	if len(auth) < 6 || !strings.EqualFold(auth[:6], "Basic ") {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(auth[6:])
+	if err != nil {
+		return false
+	}
+	username, password := string(decoded), ""
+	if i := strings.Index(username, ":"); i >= 0 {
+		username, password = username[:i], username[i+1:]
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(username), []byte(h.Username)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(password), []byte(h.Password)) == 1
+	return userOK && passOK
+}
+
+func (h *HTTPProxy) procConnect(req *http.Request, reader *bufio.Reader, conn net.Conn) (async bool, err error) {
+	uri := req.Host
+	if len(uri) < 1 {
+		uri = req.RequestURI
+	}
+	DebugLog("HTTPProxy start connect to %v on %v", uri, conn.RemoteAddr())
+	_, err = fmt.Fprintf(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+	if err == nil {
+		async, err = h.ProcConn(uri, NewStringConn(&bufferedConn{Conn: conn, Reader: reader}))
+	}
+	return
+}
+
+func (h *HTTPProxy) procForward(req *http.Request, conn net.Conn) (keep bool, err error) {
+	if !req.URL.IsAbs() || len(req.URL.Host) < 1 {
+		writeHTTPError(conn, http.StatusBadRequest, "absolute-URI request is required")
+		err = fmt.Errorf("request %v is not absolute-URI", req.RequestURI)
+		return
+	}
+	uri := req.URL.Host
+	if len(req.URL.Port()) < 1 {
+		uri += ":80"
+	}
+	DebugLog("HTTPProxy start forward %v %v to %v on %v", req.Method, req.URL, uri, conn.RemoteAddr())
+	removeProxyHeaders(req.Header)
+	req.RequestURI = ""
+	local, remote := net.Pipe()
+	defer local.Close()
+	go func() {
+		async, xerr := h.ProcConn(uri, &remoteAddrConn{Conn: remote, Remote: conn.RemoteAddr().String()})
+		if !async {
+			if xerr != nil {
+				DebugLog("HTTPProxy forward to %v on %v fail with %v", uri, conn.RemoteAddr(), xerr)
+			}
+			remote.Close()
+		}
+	}()
+	written := make(chan error, 1)
+	go func() {
+		written <- req.Write(local)
+	}()
+	resp, err := http.ReadResponse(bufio.NewReader(local), req)
+	if err != nil {
+		writeHTTPError(conn, http.StatusBadGateway, err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	select {
+	case werr := <-written:
+		keep = werr == nil && !req.Close && !resp.Close
+	default:
+		//the response is arrived before request body is sent, the rest body is still on conn, so it can't be reused
+		DebugLog("HTTPProxy forward to %v on %v is responsed before request is sent", uri, conn.RemoteAddr())
+	}
+	resp.Close = !keep
+	err = resp.Write(conn)
+	return
+}
+
+var proxyHeaders = []string{"Proxy-Connection", "Proxy-Authorization", "Proxy-Authenticate"}
+
+func removeProxyHeaders(header http.Header) {
+	for _, k := range proxyHeaders {
+		header.Del(k)
+	}
+}
+
+func writeHTTPError(w io.Writer, code int, message string) {
+	fmt.Fprintf(w, "HTTP/1.1 %v %v\r\nContent-Type: text/plain\r\nContent-Length: %v\r\nConnection: close\r\n\r\n%v",
+		code, http.StatusText(code), len(message), message)
+}
+
+//bufferedConn is net.Conn which reading from buffered reader
+type bufferedConn struct {
+	net.Conn
+	Reader io.Reader
+}
+
+func (b *bufferedConn) Read(p []byte) (n int, err error) {
+	n, err = b.Reader.Read(p)
+	return
+}
@@ -0,0 +1,119 @@
+package webdebugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestHTTPProxy(t *testing.T) {
+	go func() {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "ok%v", r.URL.Path)
+		})
+		server := &http.Server{Addr: ":10031", Handler: mux}
+		server.ListenAndServe()
+	}()
+	proxy := NewHTTPProxy()
+	proxy.ProcConn = func(uri string, raw net.Conn) (async bool, err error) {
+		conn, err := net.Dial("tcp", uri)
+		if err == nil {
+			go io.Copy(conn, raw)
+			_, err = io.Copy(raw, conn)
+		}
+		return
+	}
+	err := proxy.Listen(":10032")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	go proxy.Run()
+	defer proxy.Close()
+	time.Sleep(100 * time.Millisecond)
+	//
+	//forward
+	proxyURL, _ := url.Parse("http://127.0.0.1:10032")
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyURL(proxyURL),
+		},
+	}
+	for _, path := range []string{"/a", "/b"} {
+		resp, err := doGet(client, "http://127.0.0.1:10031"+path)
+		if err != nil || resp != "ok"+path {
+			t.Errorf("err:%v,resp:%v", err, resp)
+			return
+		}
+	}
+	//
+	//connect
+	conn, err := net.Dial("tcp", "127.0.0.1:10032")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "CONNECT 127.0.0.1:10031 HTTP/1.1\r\nHost: 127.0.0.1:10031\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil || resp.StatusCode != 200 {
+		t.Errorf("err:%v,resp:%v", err, resp)
+		return
+	}
+	fmt.Fprintf(conn, "GET /c HTTP/1.1\r\nHost: 127.0.0.1:10031\r\n\r\n")
+	resp, err = http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	if string(data) != "ok/c" {
+		t.Errorf("resp:%v", string(data))
+		return
+	}
+	//
+	//early response
+	early, _ := net.Listen("tcp", "127.0.0.1:10033")
+	defer early.Close()
+	go func() {
+		c, err := early.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		http.ReadRequest(bufio.NewReader(c))
+		fmt.Fprintf(c, "HTTP/1.1 401 Unauthorized\r\nContent-Length: 0\r\n\r\n")
+		time.Sleep(time.Second)
+	}()
+	conn3, _ := net.Dial("tcp", "127.0.0.1:10032")
+	fmt.Fprintf(conn3, "POST http://127.0.0.1:10033/ HTTP/1.1\r\nHost: 127.0.0.1:10033\r\nContent-Length: 100\r\n\r\n0123456789")
+	reader3 := bufio.NewReader(conn3)
+	resp, err = http.ReadResponse(reader3, nil)
+	if err != nil || resp.StatusCode != 401 || !resp.Close {
+		t.Errorf("err:%v,resp:%v", err, resp)
+		return
+	}
+	fmt.Fprintf(conn3, "GET http://127.0.0.1:10031/d HTTP/1.1\r\nHost: 127.0.0.1:10031\r\n\r\n")
+	if _, err = reader3.ReadByte(); err == nil {
+		t.Error("error")
+		return
+	}
+	conn3.Close()
+	//
+	//error
+	conn2, _ := net.Dial("tcp", "127.0.0.1:10032")
+	fmt.Fprintf(conn2, "GET /c HTTP/1.1\r\nHost: 127.0.0.1:10031\r\n\r\n")
+	resp, err = http.ReadResponse(bufio.NewReader(conn2), nil)
+	if err != nil || resp.StatusCode != 400 {
+		t.Errorf("err:%v,resp:%v", err, resp)
+	}
+	conn2.Close()
+}
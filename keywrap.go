@@ -0,0 +1,117 @@
+package webdebugger
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+//the supported key wrap algorithm to deliver private key from TLSCertCenter to TLSDecorder,
+//the wrapped key is nonce+AES-256-GCM sealed key with the host as additional data.
+//
+//  KeyWrapX25519 the AES key is derived by HKDF from ECDH of client public key and server ephemeral key
+//  KeyWrapPSK    the AES key is derived by HKDF from pre-shared secret and random salt
+const (
+	KeyWrapX25519 = "x25519-aes256gcm"
+	KeyWrapPSK    = "psk-aes256gcm"
+)
+
+//KeyWrapHeader is the request header to send the base64 encoded X25519 public key of client
+const KeyWrapHeader = "X-Key-Wrap-Public-Key"
+
+var keyWrapInfo = []byte("webdebugger key wrap")
+
+//wrapKeyX25519 will wrap the key by client public key, it return the server ephemeral public key and wrapped key
+func wrapKeyX25519(clientPub []byte, key []byte, host string) (epk, wrapped []byte, err error) {
+	pub, err := ecdh.X25519().NewPublicKey(clientPub)
+	if err != nil {
+		return
+	}
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return
+	}
+	secret, err := priv.ECDH(pub)
+	if err != nil {
+		return
+	}
+	epk = priv.PublicKey().Bytes()
+	wrapped, err = sealKey(secret, append(append([]byte{}, clientPub...), epk...), host, key)
+	return
+}
+
+//unwrapKeyX25519 will unwrap the key by client private key and server ephemeral public key
+func unwrapKeyX25519(priv *ecdh.PrivateKey, epk, wrapped []byte, host string) (key []byte, err error) {
+	pub, err := ecdh.X25519().NewPublicKey(epk)
+	if err != nil {
+		return
+	}
+	secret, err := priv.ECDH(pub)
+	if err != nil {
+		return
+	}
+	key, err = openKey(secret, append(priv.PublicKey().Bytes(), epk...), host, wrapped)
+	return
+}
+
+//wrapKeyPSK will wrap the key by pre-shared secret, it return the random salt and wrapped key
+func wrapKeyPSK(psk string, key []byte, host string) (salt, wrapped []byte, err error) {
+	salt = make([]byte, 16)
+	_, err = rand.Read(salt)
+	if err == nil {
+		wrapped, err = sealKey([]byte(psk), salt, host, key)
+	}
+	return
+}
+
+//unwrapKeyPSK will unwrap the key by pre-shared secret and salt
+func unwrapKeyPSK(psk string, salt, wrapped []byte, host string) (key []byte, err error) {
+	key, err = openKey([]byte(psk), salt, host, wrapped)
+	return
+}
+
+func keyWrapAEAD(secret, salt []byte) (aead cipher.AEAD, err error) {
+	aesKey := make([]byte, 32)
+	_, err = io.ReadFull(hkdf.New(sha256.New, secret, salt, keyWrapInfo), aesKey)
+	if err != nil {
+		return
+	}
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return
+	}
+	aead, err = cipher.NewGCM(block)
+	return
+}
+
+func sealKey(secret, salt []byte, host string, key []byte) (wrapped []byte, err error) {
+	aead, err := keyWrapAEAD(secret, salt)
+	if err != nil {
+		return
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err == nil {
+		wrapped = aead.Seal(nonce, nonce, key, []byte(host))
+	}
+	return
+}
+
+func openKey(secret, salt []byte, host string, wrapped []byte) (key []byte, err error) {
+	aead, err := keyWrapAEAD(secret, salt)
+	if err != nil {
+		return
+	}
+	if len(wrapped) < aead.NonceSize() {
+		err = fmt.Errorf("invalid wrapped key")
+		return
+	}
+	key, err = aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(host))
+	return
+}
@@ -0,0 +1,61 @@
+package webdebugger
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"testing"
+)
+
+func TestKeyWrap(t *testing.T) {
+	key := []byte("private key")
+	//x25519
+	priv, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	epk, wrapped, err := wrapKeyX25519(priv.PublicKey().Bytes(), key, "a.snows.io:443")
+	if err != nil || bytes.Contains(wrapped, key) {
+		t.Errorf("err:%v", err)
+		return
+	}
+	unwrapped, err := unwrapKeyX25519(priv, epk, wrapped, "a.snows.io:443")
+	if err != nil || !bytes.Equal(unwrapped, key) {
+		t.Errorf("err:%v", err)
+		return
+	}
+	if _, err = unwrapKeyX25519(priv, epk, wrapped, "b.snows.io:443"); err == nil {
+		t.Error("error")
+		return
+	}
+	other, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	if _, err = unwrapKeyX25519(other, epk, wrapped, "a.snows.io:443"); err == nil {
+		t.Error("error")
+		return
+	}
+	//psk
+	salt, wrapped, err := wrapKeyPSK("123", key, "a.snows.io:443")
+	if err != nil || bytes.Contains(wrapped, key) {
+		t.Errorf("err:%v", err)
+		return
+	}
+	unwrapped, err = unwrapKeyPSK("123", salt, wrapped, "a.snows.io:443")
+	if err != nil || !bytes.Equal(unwrapped, key) {
+		t.Errorf("err:%v", err)
+		return
+	}
+	if _, err = unwrapKeyPSK("1234", salt, wrapped, "a.snows.io:443"); err == nil {
+		t.Error("error")
+		return
+	}
+	//error
+	if _, _, err = wrapKeyX25519([]byte("xx"), key, "a.snows.io:443"); err == nil {
+		t.Error("error")
+		return
+	}
+	if _, err = unwrapKeyX25519(priv, []byte("xx"), wrapped, "a.snows.io:443"); err == nil {
+		t.Error("error")
+		return
+	}
+	if _, err = unwrapKeyPSK("123", salt, []byte("xx"), "a.snows.io:443"); err == nil {
+		t.Error("error")
+		return
+	}
+}
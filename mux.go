@@ -0,0 +1,86 @@
+package webdebugger
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"time"
+)
+
+//MuxProxy is the proxy which sniffs the first byte of connection and dispatches it to socks5/socks4/http/tls handler,
+//so all client can using one listen address.
+//
+//the tls connection is refused when Socks or HTTP auth is required, because it can't be authorized
+type MuxProxy struct {
+	net.Listener
+	Socks        *SocksProxy
+	HTTP         *HTTPProxy
+	TLS          func(conn net.Conn)
+	SniffTimeout time.Duration
+}
+
+//NewMuxProxy will return new MuxProxy by socks/http proxy, the listener of socks/http is not used
+func NewMuxProxy(socks *SocksProxy, http *HTTPProxy) (mux *MuxProxy) {
+	mux = &MuxProxy{
+		Socks:        socks,
+		HTTP:         http,
+		SniffTimeout: 10 * time.Second,
+	}
+	return
+}
+
+//Listen the address
+func (m *MuxProxy) Listen(addr string) (err error) {
+	m.Listener, err = net.Listen("tcp", addr)
+	if err == nil {
+		InfoLog("MuxProxy listen socks5/socks4/http/tls proxy on %v", addr)
+	}
+	return
+}
+
+//Run proxy listener
+func (m *MuxProxy) Run() (err error) {
+	if m.Listener != nil {
+		m.loopAccept(m.Listener)
+	}
+	return
+}
+
+func (m *MuxProxy) loopAccept(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			break
+		}
+		go m.procConn(conn)
+	}
+}
+
+func (m *MuxProxy) procConn(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(m.SniffTimeout))
+	prefix, err := reader.Peek(1)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		DebugLog("MuxProxy sniff connection from %v fail with %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	buffered := &bufferedConn{Conn: conn, Reader: reader}
+	switch {
+	case (prefix[0] == 0x05 || prefix[0] == 0x04) && m.Socks != nil:
+		m.Socks.procConn(buffered)
+	case prefix[0] == 0x16 && m.TLS != nil && !m.authRequired():
+		m.TLS(buffered)
+	case prefix[0] >= 'A' && prefix[0] <= 'Z' && m.HTTP != nil:
+		m.HTTP.procReader(reader, conn)
+	default:
+		err = fmt.Errorf("protocol by %x is not supported", prefix[0])
+		DebugLog("MuxProxy proxy connection from %v fail with %v", conn.RemoteAddr(), err)
+		conn.Close()
+	}
+}
+
+func (m *MuxProxy) authRequired() bool {
+	return (m.Socks != nil && len(m.Socks.Username) > 0) || (m.HTTP != nil && len(m.HTTP.Username) > 0)
+}
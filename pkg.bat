@@ -15,7 +15,6 @@ xcopy wdebugger-conf.bat build\%srv_name%
 xcopy wdebugger-install.bat build\%srv_name%
 xcopy wdebugger-uninstall.bat build\%srv_name%
 xcopy default-wdebugger.json /F build\%srv_name%
-echo F | xcopy privoxy-Win.exe /F /Y build\%srv_name%\privoxy.exe
 
 
 if NOT %ERRORLEVEL% EQU 0 goto :efail
@@ -22,7 +22,6 @@ cp -f wdebugger-install.sh $srv_out
 cp -f cert.sh $srv_out
 cp -f wdebugger.service $srv_out
 cp -f default-wdebugger.json $srv_out
-cp -f privoxy-`uname` $srv_out/privoxy
 
 ###
 cd $output
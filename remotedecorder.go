@@ -0,0 +1,183 @@
+package webdebugger
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+//the channel of decord websocket message, the first byte of message is channel and the others is data
+//
+//  decordRaw   the tls bytes between browser and cert center
+//  decordPlain the decorded bytes between cert center and debuger
+const (
+	decordRaw   = 0x01
+	decordPlain = 0x02
+)
+
+//decordSend will read data from reader and send to websocket by channel
+func decordSend(ws *websocket.Conn, channel byte, reader io.Reader) (err error) {
+	buf := make([]byte, 32*1024)
+	buf[0] = channel
+	for {
+		n, rerr := reader.Read(buf[1:])
+		if n > 0 {
+			err = websocket.Message.Send(ws, buf[:n+1])
+			if err != nil {
+				return
+			}
+		}
+		if rerr != nil {
+			err = rerr
+			return
+		}
+	}
+}
+
+//decordReceive will receive message from websocket and write to raw/plain writer by channel
+func decordReceive(ws *websocket.Conn, raw, plain io.Writer) (err error) {
+	for {
+		var data []byte
+		err = websocket.Message.Receive(ws, &data)
+		if err != nil {
+			return
+		}
+		if len(data) < 1 {
+			continue
+		}
+		switch data[0] {
+		case decordRaw:
+			_, err = raw.Write(data[1:])
+		case decordPlain:
+			_, err = plain.Write(data[1:])
+		default:
+			err = fmt.Errorf("invalid decord channel %v", data[0])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+//decordPipe will pipe the raw/plain to websocket and close all when any of them is done
+func decordPipe(ws *websocket.Conn, raw, plain net.Conn) (err error) {
+	once := sync.Once{}
+	closeAll := func() {
+		once.Do(func() {
+			ws.Close()
+			raw.Close()
+			plain.Close()
+		})
+	}
+	go func() {
+		decordSend(ws, decordRaw, raw)
+		closeAll()
+	}()
+	go func() {
+		decordSend(ws, decordPlain, plain)
+		closeAll()
+	}()
+	err = decordReceive(ws, raw, plain)
+	closeAll()
+	return
+}
+
+//decord will terminate the tls connection which is streamed by websocket, so the private key is never sent to client
+func (t *TLSCertCenter) decord(w http.ResponseWriter, r *http.Request, host string, conf map[string]interface{}) {
+	var pair tls.Certificate
+	certBytes, keyBytes, err := t.loadCert(conf)
+	if err == nil {
+		pair, err = tls.X509KeyPair(certBytes, keyBytes)
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		fmt.Fprintf(w, "host config is invalid")
+		WarnLog("TlsCertCenter the %v config load cert fail with %v", host, err)
+		return
+	}
+	config := &tls.Config{}
+	config.NextProtos = append(config.NextProtos, "http/1.1")
+	config.Certificates = []tls.Certificate{pair}
+	server := websocket.Server{
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			ws.PayloadType = websocket.BinaryFrame
+			DebugLog("TlsCertCenter start decord conn to %v from %v", host, r.RemoteAddr)
+			local, remote := net.Pipe()
+			conn := tls.Server(local, config)
+			err := decordPipe(ws, remote, conn)
+			DebugLog("TlsCertCenter decord conn to %v from %v is done with %v", host, r.RemoteAddr, err)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+//RemoteTLSDecorder provider Decorder to decord connection on cert center by websocket, the private key is never sent to client.
+//the raw connection is streamed to Server like ws://host:port/decord?host=%v and the decorded data is streamed back
+type RemoteTLSDecorder struct {
+	Name       string
+	Server     string
+	Username   string
+	Password   string
+	Token      string
+	ClientCert string
+	ClientKey  string
+	ServerCA   string
+	Timeout    time.Duration
+}
+
+//NewRemoteTLSDecorder will create new RemoteTLSDecorder
+func NewRemoteTLSDecorder() (decorder *RemoteTLSDecorder) {
+	decorder = &RemoteTLSDecorder{
+		Timeout: 10 * time.Second,
+	}
+	return
+}
+
+//Decord will decord raw connection by host on cert center
+func (d *RemoteTLSDecorder) Decord(host string, raw net.Conn) (conn net.Conn, err error) {
+	ws, err := d.dial(host)
+	if err != nil {
+		InfoLog("RemoteTLSDecorder dial to %v fail with %v", d.Server, err)
+		return
+	}
+	local, remote := net.Pipe()
+	go func() {
+		err := decordPipe(ws, raw, remote)
+		DebugLog("RemoteTLSDecorder decord conn to %v is done with %v", host, err)
+	}()
+	conn = local
+	return
+}
+
+func (d *RemoteTLSDecorder) dial(host string) (ws *websocket.Conn, err error) {
+	config, err := websocket.NewConfig(fmt.Sprintf(d.Server, host), "http://localhost/")
+	if err != nil {
+		return
+	}
+	if len(d.Token) > 0 {
+		config.Header.Set("Authorization", "Bearer "+d.Token)
+	} else if len(d.Username) > 0 {
+		config.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(d.Username+":"+d.Password)))
+	}
+	if strings.HasPrefix(d.Server, "wss://") {
+		config.TlsConfig, err = newClientTLSConfig(d.ClientCert, d.ClientKey, d.ServerCA)
+		if err != nil {
+			return
+		}
+	}
+	config.Dialer = &net.Dialer{Timeout: d.Timeout}
+	ws, err = websocket.DialConfig(config)
+	if err == nil {
+		ws.PayloadType = websocket.BinaryFrame
+	}
+	return
+}
@@ -0,0 +1,112 @@
+package webdebugger
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRemoteTLSDecorder(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wdebugger")
+	defer os.RemoveAll(dir)
+	ca, _ := GenerateCA("test")
+	certA, _ := ca.Issue("a.snows.io")
+	certFileA, keyFileA := writeTestCert(dir, "a", certA)
+	password, _ := HashPassword(HashBcrypt, "123")
+	center := NewTLSCertCenter(
+		map[string]interface{}{"host": "a.snows.io:443", "cert": certFileA, "key": keyFileA, "username": "abc", "password": password},
+	)
+	tokenA, _ := NewToken()
+	tokenB, _ := NewToken()
+	center.Tokens = []*AuthToken{
+		{Name: "a", Token: HashToken(tokenA), Scopes: []string{"decord:a.snows.io:443"}},
+		{Name: "b", Token: HashToken(tokenB), Scopes: []string{"cert:a.snows.io:443"}},
+	}
+	go http.ListenAndServe(":10068", center)
+	time.Sleep(100 * time.Millisecond)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+	newDecorder := func(username, password, token string) *RemoteTLSDecorder {
+		decorder := NewRemoteTLSDecorder()
+		decorder.Server = "ws://127.0.0.1:10068/decord?host=%v"
+		decorder.Username, decorder.Password, decorder.Token = username, password, token
+		return decorder
+	}
+	testDecord := func(decorder Decorder) (err error) {
+		local, remote := net.Pipe()
+		conn, err := decorder.Decord("a.snows.io:443", remote)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		go func() {
+			buf := make([]byte, 1024)
+			n, err := conn.Read(buf)
+			if err == nil {
+				conn.Write(append([]byte("world:"), buf[:n]...))
+			}
+		}()
+		client := tls.Client(local, &tls.Config{ServerName: "a.snows.io", RootCAs: pool})
+		defer client.Close()
+		_, err = client.Write([]byte("hello"))
+		if err != nil {
+			return
+		}
+		buf := make([]byte, 1024)
+		n, err := client.Read(buf)
+		if err == nil && string(buf[:n]) != "world:hello" {
+			err = net.ErrClosed
+		}
+		return
+	}
+	//basic auth
+	if err := testDecord(newDecorder("abc", "123", "")); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := testDecord(newDecorder("abc", "1234", "")); err == nil {
+		t.Error("error")
+		return
+	}
+	//token
+	if err := testDecord(newDecorder("", "", tokenA)); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := testDecord(newDecorder("", "", tokenB)); err == nil {
+		t.Error("error")
+		return
+	}
+	//not found
+	decorder := newDecorder("abc", "123", "")
+	if _, err := decorder.Decord("b.snows.io:443", nil); err == nil {
+		t.Error("error")
+		return
+	}
+	//creator
+	created, err := DefaultDecorderCreator("remote", map[string]interface{}{
+		"type":   "RemoteTlsDecorder",
+		"server": "ws://127.0.0.1:10068/decord?host=%v",
+		"token":  tokenA,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := testDecord(created); err != nil {
+		t.Error(err)
+		return
+	}
+	//invalid server
+	decorder = newDecorder("abc", "123", "")
+	decorder.Server = "ws://127.0.0.1:10069/decord?host=%v"
+	if err := testDecord(decorder); err == nil {
+		t.Error("error")
+		return
+	}
+}
@@ -0,0 +1,139 @@
+package webdebugger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type replayContextKey struct{}
+
+//ReplayOptions is pojo to edit the captured request before replaying
+//
+//  Method  the request method, default is the captured method
+//  URL     the request uri like /path?query, or full url to change host, default is the captured url
+//  Header  the header to set, the header is removed when the value is empty
+//  Body    the request body, default is the captured body
+//  Forward the upstream to forward, it must be the Forward of configured ConfigHost, default is the Forward of matched ConfigHost
+type ReplayOptions struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Header  map[string]string `json:"header"`
+	Body    *string           `json:"body"`
+	Forward string            `json:"forward"`
+}
+
+//Replay will send the captured request by id again to the Forward of matched ConfigHost,
+//the new exchange is captured with ReplayOf to the original exchange
+func (d *Debuger) Replay(id uint64, options *ReplayOptions) (original, replay *CaptureEntry, err error) {
+	if d.Capture == nil {
+		err = fmt.Errorf("capture is not enabled")
+		return
+	}
+	original, err = d.Capture.Find(id)
+	if err != nil {
+		return
+	}
+	if options == nil {
+		options = &ReplayOptions{}
+	}
+	req, err := replayRequest(original, options)
+	if err != nil {
+		return
+	}
+	host := matchHost(d.Hosts, original.Remote)
+	if host == nil && original.Host != nil {
+		host = original.Host
+	}
+	if host == nil {
+		err = fmt.Errorf("%v is not configured", original.Remote)
+		return
+	}
+	if len(options.Forward) > 0 {
+		if !d.configuredForward(options.Forward) {
+			err = fmt.Errorf("forward %v is not configured", options.Forward)
+			return
+		}
+		copied := *host
+		copied.Forward = options.Forward
+		host = &copied
+	}
+	InfoLog("Debuger start replay exchange %v to %v by forwarding to %v", id, req.URL, host.Forward)
+	replay = d.forward(&replayWriter{header: http.Header{}}, req, host)
+	if replay == nil {
+		err = fmt.Errorf("forward to %v fail", host.Forward)
+	}
+	return
+}
+
+//configuredForward will check the forward is configured on hosts, so the captured credential is not sent to other upstream
+func (d *Debuger) configuredForward(forward string) bool {
+	for _, host := range d.Hosts {
+		if host.Forward == forward {
+			return true
+		}
+	}
+	return false
+}
+
+func replayRequest(original *CaptureEntry, options *ReplayOptions) (req *http.Request, err error) {
+	method := original.Request.Method
+	if len(options.Method) > 0 {
+		method = options.Method
+	}
+	body := original.Request.Body
+	if options.Body != nil {
+		body = []byte(*options.Body)
+	} else if original.Request.Truncated {
+		err = fmt.Errorf("the body of exchange %v is truncated", original.ID)
+		return
+	}
+	target, err := url.Parse(original.Request.URL)
+	if err != nil {
+		return
+	}
+	if len(options.URL) > 0 {
+		target, err = target.Parse(options.URL)
+		if err != nil {
+			return
+		}
+	}
+	req, err = http.NewRequest(method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header = original.Request.Header.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	for key, val := range options.Header {
+		if len(val) > 0 {
+			req.Header.Set(key, val)
+		} else {
+			req.Header.Del(key)
+		}
+	}
+	req.Header.Del("Content-Length")
+	req.RemoteAddr = original.Remote
+	req.RequestURI = target.RequestURI()
+	req = req.WithContext(context.WithValue(req.Context(), replayContextKey{}, original.ID))
+	return
+}
+
+//replayWriter is the http.ResponseWriter to discard the replayed response, the response is recorded by capture
+type replayWriter struct {
+	header http.Header
+}
+
+func (r *replayWriter) Header() http.Header {
+	return r.header
+}
+
+func (r *replayWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (r *replayWriter) WriteHeader(status int) {
+}
@@ -0,0 +1,102 @@
+package webdebugger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%v %v %v %v", r.Method, r.URL.RequestURI(), r.Header.Get("X-Test"), string(body))
+	}))
+	defer upstream.Close()
+	debugger := NewDebuger(&Config{
+		Hosts:   []*ConfigHost{{Host: "a.snows.io:443", Forward: upstream.URL}},
+		Capture: &CaptureConfig{MaxBody: 20},
+	})
+	serve := func(method, path, body string) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Host = "a.snows.io"
+		req.RemoteAddr = "a.snows.io:443"
+		req.Header.Set("X-Test", "1")
+		debugger.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	serve("POST", "/abc?a=1", "123")
+	serve("POST", "/abc", "123456789012345678901")
+	//replay as same
+	original, replay, err := debugger.Replay(1, nil)
+	if err != nil || original.ID != 1 || replay.ReplayOf != 1 || string(replay.Response.Body) != "POST /abc?a=1 1 123" {
+		t.Errorf("err:%v,replay:%v", err, replay)
+		return
+	}
+	if replay.Request.URL != "http://a.snows.io/abc?a=1" {
+		t.Errorf("url:%v", replay.Request.URL)
+		return
+	}
+	//replay with edit
+	body := "abc"
+	_, replay, err = debugger.Replay(1, &ReplayOptions{Method: "PUT", URL: "/xyz", Header: map[string]string{"X-Test": "2"}, Body: &body})
+	if err != nil || string(replay.Response.Body) != "PUT /xyz 2 abc" {
+		t.Errorf("err:%v,replay:%v", err, replay)
+		return
+	}
+	_, replay, err = debugger.Replay(1, &ReplayOptions{Header: map[string]string{"X-Test": ""}})
+	if err != nil || string(replay.Response.Body) != "POST /abc?a=1  123" {
+		t.Errorf("err:%v,replay:%v", err, replay)
+		return
+	}
+	//replay to other forward
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "other")
+	}))
+	defer other.Close()
+	if _, _, err = debugger.Replay(1, &ReplayOptions{Forward: other.URL}); err == nil { //not configured
+		t.Error("error")
+		return
+	}
+	debugger.Hosts = append(debugger.Hosts, &ConfigHost{Host: "other.snows.io:443", Forward: other.URL})
+	_, replay, err = debugger.Replay(1, &ReplayOptions{Forward: other.URL})
+	if err != nil || string(replay.Response.Body) != "other" || replay.Host.Forward != other.URL {
+		t.Errorf("err:%v,replay:%v", err, replay)
+		return
+	}
+	//error
+	if _, _, err = debugger.Replay(2, nil); err == nil { //truncated
+		t.Error("error")
+		return
+	}
+	if _, _, err = debugger.Replay(2, &ReplayOptions{Body: &body}); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, _, err = debugger.Replay(100, nil); err == nil {
+		t.Error("error")
+		return
+	}
+	if _, _, err = debugger.Replay(1, &ReplayOptions{URL: "%zz"}); err == nil {
+		t.Error("error")
+		return
+	}
+	if _, _, err = debugger.Replay(1, &ReplayOptions{Method: "a b"}); err == nil {
+		t.Error("error")
+		return
+	}
+	if _, _, err = debugger.Replay(1, &ReplayOptions{Forward: "%zz"}); err == nil {
+		t.Error("error")
+		return
+	}
+	debugger.Capture.Add(&CaptureEntry{Remote: "b.snows.io:443", Request: &CaptureMessage{URL: "https://b.snows.io"}, Response: &CaptureMessage{}})
+	if _, _, err = debugger.Replay(debugger.Capture.lastID, nil); err == nil {
+		t.Error("error")
+		return
+	}
+	if _, _, err = NewDebuger(&Config{}).Replay(1, nil); err == nil {
+		t.Error("error")
+		return
+	}
+}
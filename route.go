@@ -0,0 +1,140 @@
+package webdebugger
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+//the route match rank of ConfigHost.Host/ConfigHost.IP to uri, the lower rank is preferred
+//and the first configured host is used when rank is equal.
+//
+//  rankExact       host:port or ip:port is equal to uri, like wdebugger.snows.io:443
+//  rankHost        host or ip without port or with * port, like wdebugger.snows.io or wdebugger.snows.io:*
+//  rankWildcard    wildcard host with port, like *.snows.io:443
+//  rankWildcardAll wildcard host without port or with * port, like *.snows.io or *.snows.io:*
+//  rankCIDR        ip is CIDR range with optional port, like 192.168.1.0/24 or 192.168.1.0/24:443
+//  rankRegexp      regexp started with ~ matched to uri, like ~^api[0-9]+\.snows\.io:443$
+const (
+	rankExact = iota
+	rankHost
+	rankWildcard
+	rankWildcardAll
+	rankCIDR
+	rankRegexp
+	rankNone
+)
+
+var routeRegexps = map[string]*regexp.Regexp{}
+var routeRegexpsLck = sync.RWMutex{}
+
+func routeRegexp(pattern string) (reg *regexp.Regexp) {
+	routeRegexpsLck.RLock()
+	reg, ok := routeRegexps[pattern]
+	routeRegexpsLck.RUnlock()
+	if ok {
+		return
+	}
+	reg, err := regexp.Compile(pattern)
+	if err != nil {
+		WarnLog("Debuger compile route regexp %v fail with %v", pattern, err)
+		reg = nil
+	}
+	routeRegexpsLck.Lock()
+	routeRegexps[pattern] = reg
+	routeRegexpsLck.Unlock()
+	return
+}
+
+//matchHost will return the best matched host config by uri, see rank* for the precedence
+func matchHost(hosts []*ConfigHost, uri string) (host *ConfigHost) {
+	best := rankNone
+	for _, h := range hosts {
+		rank := h.match(uri)
+		if rank < best {
+			best, host = rank, h
+			if rank == rankExact {
+				break
+			}
+		}
+	}
+	return
+}
+
+//match will return the match rank of uri, it return rankNone when not matched
+func (c *ConfigHost) match(uri string) (rank int) {
+	rank = rankNone
+	if len(c.Host) > 0 {
+		if r := matchPattern(c.Host, uri); r < rank {
+			rank = r
+		}
+	}
+	if len(c.IP) > 0 {
+		if r := matchPattern(c.IP, uri); r < rank {
+			rank = r
+		}
+	}
+	return
+}
+
+//decordHost will return the host name to decord, it is the configured host when it is plain host:port, else the uri
+func (c *ConfigHost) decordHost(uri string) string {
+	host, port := splitHostPort(c.Host)
+	if len(port) < 1 || port == "*" || strings.ContainsAny(host, "*/~") {
+		return uri
+	}
+	return c.Host
+}
+
+func splitHostPort(uri string) (host, port string) {
+	host, port, err := net.SplitHostPort(uri)
+	if err != nil {
+		host, port = strings.TrimSuffix(strings.TrimPrefix(uri, "["), "]"), ""
+	}
+	return
+}
+
+func matchPattern(pattern, uri string) (rank int) {
+	rank = rankNone
+	if pattern == uri {
+		rank = rankExact
+		return
+	}
+	if strings.HasPrefix(pattern, "~") {
+		if reg := routeRegexp(pattern[1:]); reg != nil && reg.MatchString(uri) {
+			rank = rankRegexp
+		}
+		return
+	}
+	host, port := splitHostPort(uri)
+	patternHost, patternPort := splitHostPort(pattern)
+	if len(patternPort) > 0 && patternPort != "*" && patternPort != port {
+		return
+	}
+	anyPort := len(patternPort) < 1 || patternPort == "*"
+	switch {
+	case strings.EqualFold(patternHost, host):
+		if anyPort {
+			rank = rankHost
+		} else {
+			rank = rankExact
+		}
+	case strings.HasPrefix(patternHost, "*."):
+		suffix := strings.ToLower(patternHost[1:])
+		if strings.HasSuffix(strings.ToLower(host), suffix) && len(host) > len(suffix) {
+			if anyPort {
+				rank = rankWildcardAll
+			} else {
+				rank = rankWildcard
+			}
+		}
+	case strings.Contains(patternHost, "/"):
+		_, network, err := net.ParseCIDR(patternHost)
+		ip := net.ParseIP(host)
+		if err == nil && ip != nil && network.Contains(ip) {
+			rank = rankCIDR
+		}
+	}
+	return
+}
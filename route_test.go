@@ -0,0 +1,58 @@
+package webdebugger
+
+import "testing"
+
+func TestMatchHost(t *testing.T) {
+	hosts := []*ConfigHost{
+		{Host: "~^api[0-9]+\\.snows\\.io:443$", Forward: "regexp"},
+		{IP: "10.0.0.0/8", Forward: "cidr"},
+		{IP: "192.168.0.0/16:8080", Forward: "cidr-port"},
+		{Host: "*.snows.io", Forward: "wildcard-all"},
+		{Host: "*.snows.io:443", Forward: "wildcard"},
+		{Host: "wdebugger.snows.io", Forward: "host"},
+		{Host: "wdebugger.snows.io:443", IP: "1.2.3.4:443", Forward: "exact"},
+		{Host: "[::1]:443", Forward: "exact-ipv6"},
+		{Host: "~[", Forward: "regexp-error"},
+	}
+	cases := map[string]string{
+		"wdebugger.snows.io:443":  "exact",
+		"WDebugger.snows.io:443":  "exact",
+		"1.2.3.4:443":             "exact",
+		"wdebugger.snows.io:80":   "host",
+		"a.snows.io:443":          "wildcard",
+		"a.b.snows.io:443":        "wildcard",
+		"a.snows.io:80":           "wildcard-all",
+		"api1.snows.io:443":       "wildcard",
+		"api1.xxx.io:443":         "",
+		"snows.io:443":            "",
+		"10.1.2.3:443":            "cidr",
+		"192.168.1.1:8080":        "cidr-port",
+		"192.168.1.1:80":          "",
+		"[::1]:443":               "exact-ipv6",
+		"[::1]:80":                "",
+		"xx":                      "",
+		"api10.snows.io:443":      "wildcard",
+		"api10.snows.io.xxx:443":  "",
+		"wdebugger.snows.io:8443": "host",
+	}
+	for uri, forward := range cases {
+		host := matchHost(hosts, uri)
+		if (host == nil && len(forward) > 0) || (host != nil && host.Forward != forward) {
+			t.Errorf("uri:%v,expect:%v,host:%v", uri, forward, host)
+		}
+	}
+	//regexp only
+	host := matchHost(hosts[:1], "api10.snows.io:443")
+	if host == nil || host.Forward != "regexp" {
+		t.Errorf("host:%v", host)
+	}
+	//decord host
+	for uri, expect := range map[string]string{
+		"1.2.3.4:443":    "wdebugger.snows.io:443",
+		"a.snows.io:443": "a.snows.io:443",
+	} {
+		if name := matchHost(hosts, uri).decordHost(uri); name != expect {
+			t.Errorf("uri:%v,expect:%v,name:%v", uri, expect, name)
+		}
+	}
+}
@@ -1,21 +1,33 @@
 package webdebugger
 
 import (
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
 )
 
-//SocksProxy is an implementation of socks5 proxy
+//SocksProxy is an implementation of socks5 and socks4/socks4a proxy
 type SocksProxy struct {
 	net.Listener
 	HTTPUpstream string
+	Username     string
+	Password     string
 	ProcConn     func(uri string, raw net.Conn) (async bool, err error)
+	ProcUDP      func(uri string) (target string, err error)
+	BindTimeout  time.Duration
 }
 
 //NewSocksProxy will return new SocksProxy
 func NewSocksProxy() (socks *SocksProxy) {
-	socks = &SocksProxy{}
+	socks = &SocksProxy{
+		BindTimeout: 2 * time.Minute,
+	}
 	return
 }
 
@@ -63,8 +75,13 @@ func (s *SocksProxy) procConn(conn net.Conn) {
 	if err != nil {
 		return
 	}
+	if buf[0] == 0x04 {
+		async, err = s.procSocks4(conn, buf)
+		return
+	}
 	if buf[0] != 0x05 {
-		if len(s.HTTPUpstream) < 1 {
+		//the http upstream is not authorized by socks, so it is disabled when auth is required
+		if len(s.HTTPUpstream) < 1 || len(s.Username) > 0 {
 			err = fmt.Errorf("only ver 0x05 is supported, but %x", buf[0])
 			return
 		}
@@ -84,7 +101,7 @@ func (s *SocksProxy) procConn(conn net.Conn) {
 	if err != nil {
 		return
 	}
-	_, err = conn.Write([]byte{0x05, 0x00})
+	err = s.procMethod(conn, buf[2:2+buf[1]])
 	if err != nil {
 		return
 	}
@@ -114,28 +131,277 @@ func (s *SocksProxy) procConn(conn net.Conn) {
 			port := uint16(buf[buf[4]+5])*256 + uint16(buf[buf[4]+6])
 			uri = fmt.Sprintf("%v:%v", remote, port)
 		}
+	case 0x04:
+		err = fullBuf(conn, buf[5:], 17)
+		if err == nil {
+			remote := net.IP(buf[4:20])
+			port := uint16(buf[20])*256 + uint16(buf[21])
+			uri = net.JoinHostPort(remote.String(), fmt.Sprintf("%v", port))
+		}
 	default:
 		err = fmt.Errorf("ATYP %v is not supported", buf[3])
 		return
 	}
-	DebugLog("SocksProxy start dial to %v on %v", uri, conn.RemoteAddr())
-	// if err != nil {
-	// 	buf[0], buf[1], buf[2], buf[3] = 0x05, 0x04, 0x00, 0x01
-	// 	buf[4], buf[5], buf[6], buf[7] = 0x00, 0x00, 0x00, 0x00
-	// 	buf[8], buf[9] = 0x00, 0x00
-	// 	buf[1] = 0x01
-	// 	conn.Write(buf[:10])
-	// 	InfoLog("SocksProxy dial to %v on %v fail with %v", uri, conn.RemoteAddr(), err)
-	// 	pending.Close()
-	// 	return
-	// }
-	buf[0], buf[1], buf[2], buf[3] = 0x05, 0x00, 0x00, 0x01
-	buf[4], buf[5], buf[6], buf[7] = 0x00, 0x00, 0x00, 0x00
-	buf[8], buf[9] = 0x00, 0x00
-	_, err = conn.Write(buf[:10])
+	if err != nil {
+		return
+	}
+	switch buf[1] {
+	case 0x01:
+		DebugLog("SocksProxy start dial to %v on %v", uri, conn.RemoteAddr())
+		reply := newSocksReplyConn(conn)
+		async, err = s.ProcConn(uri, reply)
+		if err != nil {
+			if sent, _ := reply.Reply(replyCode(err), nil); sent {
+				InfoLog("SocksProxy dial to %v on %v fail with %v", uri, conn.RemoteAddr(), err)
+			}
+		}
+	case 0x02:
+		DebugLog("SocksProxy start bind for %v on %v", uri, conn.RemoteAddr())
+		err = s.procBind(conn, uri)
+	case 0x03:
+		DebugLog("SocksProxy start udp associate for %v on %v", uri, conn.RemoteAddr())
+		err = s.procUDP(conn, uri)
+	default:
+		conn.Write(socksReply(0x07, nil))
+		err = fmt.Errorf("CMD %v is not supported", buf[1])
+	}
+}
+
+//procBind will proc the bind command on control connection, the uri is the address of expected incoming peer
+func (s *SocksProxy) procBind(control net.Conn, uri string) (err error) {
+	localIP := net.IPv4zero
+	if local, ok := control.LocalAddr().(*net.TCPAddr); ok {
+		localIP = local.IP
+	}
+	ln, err := net.ListenTCP("tcp", &net.TCPAddr{IP: localIP})
+	if err != nil {
+		control.Write(socksReply(replyCode(err), nil))
+		return
+	}
+	defer ln.Close()
+	bound := &net.TCPAddr{IP: localIP, Port: ln.Addr().(*net.TCPAddr).Port}
+	_, err = control.Write(socksReply(0x00, bound))
+	if err != nil {
+		return
+	}
+	InfoLog("SocksProxy start bind on %v for %v", bound, control.RemoteAddr())
+	expect, _, _ := net.SplitHostPort(uri)
+	expectIP := net.ParseIP(expect)
+	if expectIP != nil && expectIP.IsUnspecified() {
+		expectIP = nil
+	}
+	ln.SetDeadline(time.Now().Add(s.BindTimeout))
+	var peer *net.TCPConn
+	for {
+		peer, err = ln.AcceptTCP()
+		if err != nil {
+			control.Write(socksReply(replyCode(err), nil))
+			return
+		}
+		remote := peer.RemoteAddr().(*net.TCPAddr)
+		if expectIP == nil || expectIP.Equal(remote.IP) {
+			break
+		}
+		DebugLog("SocksProxy bind on %v reject unexpected peer %v", bound, remote)
+		peer.Close()
+	}
+	defer peer.Close()
+	_, err = control.Write(socksReply(0x00, peer.RemoteAddr()))
+	if err != nil {
+		return
+	}
+	InfoLog("SocksProxy bind on %v accept peer %v for %v", bound, peer.RemoteAddr(), control.RemoteAddr())
+	go io.Copy(peer, control)
+	_, err = io.Copy(control, peer)
+	return
+}
+
+//procMethod will select method from methods and do the sub-negotiation
+func (s *SocksProxy) procMethod(conn net.Conn, methods []byte) (err error) {
+	method := byte(0x00)
+	if len(s.Username) > 0 {
+		method = 0x02
+	}
+	var offered bool
+	for _, m := range methods {
+		if m == method {
+			offered = true
+			break
+		}
+	}
+	if !offered {
+		conn.Write([]byte{0x05, 0xFF})
+		err = fmt.Errorf("no acceptable method in %x", methods)
+		return
+	}
+	_, err = conn.Write([]byte{0x05, method})
+	if err != nil || method == 0x00 {
+		return
+	}
+	//
+	//Username/Password sub-negotiation, RFC 1929
+	buf := make([]byte, 256)
+	err = fullBuf(conn, buf, 2)
+	if err != nil {
+		return
+	}
+	if buf[0] != 0x01 {
+		err = fmt.Errorf("only auth ver 0x01 is supported, but %x", buf[0])
+		return
+	}
+	ulen := uint32(buf[1])
+	err = fullBuf(conn, buf, ulen+1)
+	if err != nil {
+		return
+	}
+	username := string(buf[:ulen])
+	plen := uint32(buf[ulen])
+	err = fullBuf(conn, buf, plen)
+	if err != nil {
+		return
+	}
+	password := string(buf[:plen])
+	userOK := subtle.ConstantTimeCompare([]byte(username), []byte(s.Username)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(password), []byte(s.Password)) == 1
+	if !userOK || !passOK {
+		conn.Write([]byte{0x01, 0x01})
+		err = fmt.Errorf("auth fail by username %v", username)
+		return
+	}
+	_, err = conn.Write([]byte{0x01, 0x00})
+	return
+}
+
+//ReplyError is the error with socks reply code
+type ReplyError struct {
+	Err error
+	Rep byte
+}
+
+func (r *ReplyError) Error() string {
+	return r.Err.Error()
+}
+
+//Code will return the socks reply code
+func (r *ReplyError) Code() byte {
+	return r.Rep
+}
+
+func replyCode(err error) byte {
+	if codable, ok := err.(interface{ Code() byte }); ok {
+		return codable.Code()
+	}
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return 0x05
+	case errors.Is(err, syscall.ENETUNREACH):
+		return 0x03
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.As(err, &dnsErr):
+		return 0x04
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return 0x06
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return 0x06
+	}
+	return 0x01
+}
+
+//socksReplyConn is net.Conn which will send the success reply before first read/write
+type socksReplyConn struct {
+	net.Conn
+	bound    net.Addr
+	replied  bool
+	replyErr error
+	encode   func(rep byte, bound net.Addr) []byte
+	lck      sync.Mutex
+}
+
+func newSocksReplyConn(raw net.Conn) (conn *socksReplyConn) {
+	conn = &socksReplyConn{
+		Conn:   raw,
+		encode: socksReply,
+		lck:    sync.Mutex{},
+	}
+	return
+}
+
+//SetBound will set the real bound address to reply
+func (s *socksReplyConn) SetBound(addr net.Addr) {
+	s.lck.Lock()
+	s.bound = addr
+	s.lck.Unlock()
+}
+
+//Reply will send reply with code and bound address, it return false if reply is sent before.
+//if bound is nil, using the setted bound or local address
+func (s *socksReplyConn) Reply(rep byte, bound net.Addr) (sent bool, err error) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	if s.replied {
+		err = s.replyErr
+		return
+	}
+	if bound == nil {
+		bound = s.bound
+	}
+	if bound == nil && rep == 0x00 {
+		bound = s.Conn.LocalAddr()
+	}
+	_, err = s.Conn.Write(s.encode(rep, bound))
+	s.replied, s.replyErr, sent = true, err, true
+	return
+}
+
+func (s *socksReplyConn) Read(p []byte) (n int, err error) {
+	_, err = s.Reply(0x00, nil)
+	if err == nil {
+		n, err = s.Conn.Read(p)
+	}
+	return
+}
+
+func (s *socksReplyConn) Write(p []byte) (n int, err error) {
+	_, err = s.Reply(0x00, nil)
 	if err == nil {
-		async, err = s.ProcConn(uri, NewStringConn(conn))
+		n, err = s.Conn.Write(p)
 	}
+	return
+}
+
+func (s *socksReplyConn) String() string {
+	return remoteAddr(s.Conn)
+}
+
+func socksReply(rep byte, bound net.Addr) (buf []byte) {
+	var ip net.IP
+	var port int
+	switch addr := bound.(type) {
+	case *net.TCPAddr:
+		ip, port = addr.IP, addr.Port
+	case *net.UDPAddr:
+		ip, port = addr.IP, addr.Port
+	}
+	buf = append([]byte{0x05, rep, 0x00}, socksAddr(ip, port)...)
+	return
+}
+
+//socksAddr will encode ip/port to ATYP/ADDR/PORT, the ipv4 0.0.0.0 is used when ip is nil
+func socksAddr(ip net.IP, port int) (buf []byte) {
+	if ip4 := ip.To4(); ip4 != nil || ip == nil {
+		buf = []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+		if ip4 != nil {
+			copy(buf[1:5], ip4)
+			buf[5], buf[6] = byte(port>>8), byte(port)
+		}
+		return
+	}
+	buf = make([]byte, 19)
+	buf[0] = 0x04
+	copy(buf[1:17], ip.To16())
+	buf[17], buf[18] = byte(port>>8), byte(port)
+	return
 }
 
 func fullBuf(r io.Reader, p []byte, length uint32) error {
@@ -0,0 +1,80 @@
+package webdebugger
+
+import (
+	"fmt"
+	"net"
+)
+
+//procSocks4 will proc socks4/socks4a request, the first two bytes is readed to buf
+func (s *SocksProxy) procSocks4(conn net.Conn, buf []byte) (async bool, err error) {
+	err = fullBuf(conn, buf[2:], 6)
+	if err != nil {
+		return
+	}
+	cmd := buf[1]
+	port := uint16(buf[2])*256 + uint16(buf[3])
+	remote := net.IP(append([]byte{}, buf[4:8]...)).String()
+	socks4a := buf[4] == 0 && buf[5] == 0 && buf[6] == 0 && buf[7] != 0
+	userid, err := readNullString(conn, buf, 255)
+	if err != nil {
+		return
+	}
+	if socks4a {
+		remote, err = readNullString(conn, buf, 255)
+		if err != nil {
+			return
+		}
+	}
+	uri := net.JoinHostPort(remote, fmt.Sprintf("%v", port))
+	if len(s.Username) > 0 {
+		conn.Write(socks4Reply(0x02, nil))
+		err = fmt.Errorf("socks4 is not allowed when auth is required, userid:%v", userid)
+		return
+	}
+	if cmd != 0x01 {
+		conn.Write(socks4Reply(0x07, nil))
+		err = fmt.Errorf("socks4 CD %v is not supported", cmd)
+		return
+	}
+	DebugLog("SocksProxy start socks4 dial to %v on %v", uri, conn.RemoteAddr())
+	reply := newSocksReplyConn(conn)
+	reply.encode = socks4Reply
+	async, err = s.ProcConn(uri, reply)
+	if err != nil {
+		if sent, _ := reply.Reply(replyCode(err), nil); sent {
+			InfoLog("SocksProxy socks4 dial to %v on %v fail with %v", uri, conn.RemoteAddr(), err)
+		}
+	}
+	return
+}
+
+//socks4Reply will encode the socks4 reply, the socks5 success rep is granted and other is rejected
+func socks4Reply(rep byte, bound net.Addr) (buf []byte) {
+	buf = []byte{0x00, 0x5A, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	if rep != 0x00 {
+		buf[1] = 0x5B
+	}
+	if addr, ok := bound.(*net.TCPAddr); ok {
+		if ip4 := addr.IP.To4(); ip4 != nil {
+			buf[2], buf[3] = byte(addr.Port>>8), byte(addr.Port)
+			copy(buf[4:], ip4)
+		}
+	}
+	return
+}
+
+//readNullString will read the null-terminated string from conn
+func readNullString(conn net.Conn, buf []byte, max int) (value string, err error) {
+	for i := 0; i < max; i++ {
+		err = fullBuf(conn, buf[i:], 1)
+		if err != nil {
+			return
+		}
+		if buf[i] == 0x00 {
+			value = string(buf[:i])
+			return
+		}
+	}
+	err = fmt.Errorf("string is too long")
+	return
+}
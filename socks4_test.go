@@ -0,0 +1,71 @@
+package webdebugger
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSocks4(t *testing.T) {
+	proxy := NewSocksProxy()
+	var target string
+	proxy.ProcConn = func(uri string, raw net.Conn) (async bool, err error) {
+		target = uri
+		if uri == "fail.test:80" {
+			err = &ReplyError{Err: net.UnknownNetworkError("fail"), Rep: 0x04}
+			return
+		}
+		raw.(interface{ SetBound(addr net.Addr) }).SetBound(&net.TCPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 80})
+		_, err = raw.Write([]byte("ok"))
+		return
+	}
+	request := func(req []byte, replyLen uint32) (reply []byte, err error) {
+		conn, conb, _ := CreatePipeConn()
+		defer conn.Close()
+		go proxy.procConn(conb)
+		conn.Write(req)
+		reply = make([]byte, 10)
+		err = fullBuf(conn, reply, replyLen)
+		return
+	}
+	//socks4
+	reply, err := request([]byte{0x04, 0x01, 0x00, 0x50, 127, 0, 0, 1, 'u', 0x00}, 10)
+	if err != nil || reply[1] != 0x5A || target != "127.0.0.1:80" || reply[7] != 4 || string(reply[8:]) != "ok" {
+		t.Errorf("err:%v,reply:%x,target:%v", err, reply, target)
+		return
+	}
+	//socks4a
+	reply, err = request([]byte{0x04, 0x01, 0x01, 0xBB, 0, 0, 0, 1, 0x00, 'a', '.', 't', 'e', 's', 't', 0x00}, 10)
+	if err != nil || reply[1] != 0x5A || target != "a.test:443" {
+		t.Errorf("err:%v,reply:%x,target:%v", err, reply, target)
+		return
+	}
+	//fail
+	reply, err = request([]byte{0x04, 0x01, 0x00, 0x50, 0, 0, 0, 1, 0x00, 'f', 'a', 'i', 'l', '.', 't', 'e', 's', 't', 0x00}, 8)
+	if err != nil || reply[1] != 0x5B {
+		t.Errorf("err:%v,reply:%x,target:%v", err, reply, target)
+		return
+	}
+	//bind is not supported
+	reply, err = request([]byte{0x04, 0x02, 0x00, 0x50, 127, 0, 0, 1, 0x00}, 8)
+	if err != nil || reply[1] != 0x5B {
+		t.Errorf("err:%v,reply:%x", err, reply)
+		return
+	}
+	//auth required
+	proxy.Username = "abc"
+	reply, err = request([]byte{0x04, 0x01, 0x00, 0x50, 127, 0, 0, 1, 0x00}, 8)
+	if err != nil || reply[1] != 0x5B {
+		t.Errorf("err:%v,reply:%x", err, reply)
+		return
+	}
+	//too long
+	req := append([]byte{0x04, 0x01, 0x00, 0x50, 127, 0, 0, 1}, make([]byte, 300)...)
+	for i := 8; i < len(req); i++ {
+		req[i] = 'a'
+	}
+	_, err = request(req, 8)
+	if err == nil {
+		t.Error("error")
+		return
+	}
+}
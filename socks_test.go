@@ -140,8 +140,8 @@ func proxyDialIPv6(t *testing.T, bys []byte, port uint16) {
 	}
 	buf[0], buf[1], buf[2], buf[3] = 0x05, 0x01, 0x00, 0x04
 	copy(buf[4:], bys)
-	binary.BigEndian.PutUint16(buf[8:], port)
-	_, err = conn.Write(buf[:10])
+	binary.BigEndian.PutUint16(buf[20:], port)
+	_, err = conn.Write(buf[:22])
 	if err != nil {
 		return
 	}
@@ -178,14 +178,12 @@ func TestSocksProxy(t *testing.T) {
 		fmt.Println("dial to ", uri, err)
 		return
 	}
-	go func() {
-		err := proxy.Listen(":2081")
-		if err != nil {
-			t.Error(err)
-			return
-		}
-		proxy.Run()
-	}()
+	err := proxy.Listen(":2081")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	go proxy.Run()
 	proxyDial(t, "localhost", 80)
 	proxyDial2(t, "localhost:80", 0)
 	proxyDial(t, "localhost", 81)
@@ -238,6 +236,252 @@ func TestSocksProxy(t *testing.T) {
 	proxy.Close()
 }
 
+func TestSocksProxyAuth(t *testing.T) {
+	proxy := NewSocksProxy()
+	proxy.Username, proxy.Password = "abc", "123"
+	proxy.ProcConn = func(uri string, raw net.Conn) (async bool, err error) {
+		raw.Write([]byte(uri))
+		return
+	}
+	auth := func(methods, sub []byte) (reply []byte, err error) {
+		conn, conb, _ := CreatePipeConn()
+		defer conn.Close()
+		go proxy.procConn(conb)
+		conn.Write(append([]byte{0x05, byte(len(methods))}, methods...))
+		reply = make([]byte, 4)
+		err = fullBuf(conn, reply, 2)
+		if err != nil || reply[1] != 0x02 {
+			return
+		}
+		conn.Write(sub)
+		err = fullBuf(conn, reply[2:], 2)
+		if err != nil || reply[3] != 0x00 {
+			return
+		}
+		buf := []byte{0x05, 0x01, 0x00, 0x03, 0x01, 'a', 0x00, 0x50}
+		conn.Write(buf)
+		resp := make([]byte, 1024)
+		err = fullBuf(conn, resp, 10+4)
+		if err == nil && string(resp[10:14]) != "a:80" {
+			err = fmt.Errorf("uri %v", string(resp[10:14]))
+		}
+		return
+	}
+	//no acceptable method
+	reply, err := auth([]byte{0x00}, nil)
+	if err != nil || reply[0] != 0x05 || reply[1] != 0xFF {
+		t.Errorf("err:%v,reply:%x", err, reply)
+		return
+	}
+	//auth fail
+	reply, err = auth([]byte{0x00, 0x02}, []byte{0x01, 0x03, 'a', 'b', 'c', 0x03, '1', '2', '4'})
+	if err != nil || reply[1] != 0x02 || reply[3] != 0x01 {
+		t.Errorf("err:%v,reply:%x", err, reply)
+		return
+	}
+	//auth success
+	reply, err = auth([]byte{0x00, 0x02}, []byte{0x01, 0x03, 'a', 'b', 'c', 0x03, '1', '2', '3'})
+	if err != nil || reply[1] != 0x02 || reply[3] != 0x00 {
+		t.Errorf("err:%v,reply:%x", err, reply)
+		return
+	}
+	//auth ver error
+	reply, err = auth([]byte{0x02}, []byte{0x05, 0x00})
+	if err == nil {
+		t.Errorf("err:%v,reply:%x", err, reply)
+		return
+	}
+	//http upstream is disabled
+	upstream, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer upstream.Close()
+	proxy.HTTPUpstream = upstream.Addr().String()
+	conn, conb, _ := CreatePipeConn()
+	go proxy.procConn(conb)
+	conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	_, err = conn.Read(make([]byte, 1))
+	if err == nil {
+		t.Error("error")
+	}
+	conn.Close()
+}
+
+func TestSocksProxyReply(t *testing.T) {
+	proxy := NewSocksProxy()
+	request := func(uri string) (reply []byte, err error) {
+		conn, conb, _ := CreatePipeConn()
+		defer conn.Close()
+		go proxy.procConn(conb)
+		conn.Write([]byte{0x05, 0x01, 0x00})
+		reply = make([]byte, 10)
+		err = fullBuf(conn, reply, 2)
+		if err != nil {
+			return
+		}
+		buf := []byte{0x05, 0x01, 0x00, 0x03, byte(len(uri))}
+		buf = append(buf, []byte(uri)...)
+		buf = append(buf, 0x00, 0x50)
+		conn.Write(buf)
+		err = fullBuf(conn, reply, 10)
+		return
+	}
+	//dial error
+	proxy.ProcConn = func(uri string, raw net.Conn) (async bool, err error) {
+		_, err = net.Dial("tcp", "127.0.0.1:1")
+		return
+	}
+	reply, err := request("a")
+	if err != nil || reply[1] != 0x05 {
+		t.Errorf("err:%v,reply:%x", err, reply)
+		return
+	}
+	//codable error
+	proxy.ProcConn = func(uri string, raw net.Conn) (async bool, err error) {
+		err = &ReplyError{Err: fmt.Errorf("not allowed"), Rep: 0x02}
+		return
+	}
+	reply, err = request("a")
+	if err != nil || reply[1] != 0x02 {
+		t.Errorf("err:%v,reply:%x", err, reply)
+		return
+	}
+	//success with bound
+	proxy.ProcConn = func(uri string, raw net.Conn) (async bool, err error) {
+		raw.(interface{ SetBound(addr net.Addr) }).SetBound(&net.TCPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 80})
+		_, err = raw.Write([]byte("ok"))
+		return
+	}
+	reply, err = request("a")
+	if err != nil || reply[1] != 0x00 || reply[3] != 0x01 || reply[4] != 1 || reply[7] != 4 || reply[9] != 80 {
+		t.Errorf("err:%v,reply:%x", err, reply)
+		return
+	}
+	//reply code
+	if replyCode(&net.DNSError{}) != 0x04 || replyCode(fmt.Errorf("xx")) != 0x01 {
+		t.Error("error")
+		return
+	}
+	if replyCode(&net.OpError{Err: &timeoutErr{}}) != 0x06 {
+		t.Error("error")
+		return
+	}
+}
+
+func TestSocksProxyIPv6(t *testing.T) {
+	proxy := NewSocksProxy()
+	var target string
+	proxy.ProcConn = func(uri string, raw net.Conn) (async bool, err error) {
+		target = uri
+		raw.(interface{ SetBound(addr net.Addr) }).SetBound(&net.TCPAddr{IP: net.ParseIP("::1"), Port: 80})
+		_, err = raw.Write([]byte("ok"))
+		return
+	}
+	conn, conb, _ := CreatePipeConn()
+	defer conn.Close()
+	go proxy.procConn(conb)
+	conn.Write([]byte{0x05, 0x01, 0x00})
+	reply := make([]byte, 24)
+	err := fullBuf(conn, reply, 2)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	buf := []byte{0x05, 0x01, 0x00, 0x04}
+	buf = append(buf, net.ParseIP("fe80::1")...)
+	buf = append(buf, 0x01, 0xBB)
+	conn.Write(buf)
+	err = fullBuf(conn, reply, 24)
+	if err != nil || target != "[fe80::1]:443" {
+		t.Errorf("err:%v,target:%v", err, target)
+		return
+	}
+	if reply[1] != 0x00 || reply[3] != 0x04 || !net.IP(reply[4:20]).Equal(net.ParseIP("::1")) || reply[21] != 80 {
+		t.Errorf("reply:%x", reply)
+		return
+	}
+	if string(reply[22:24]) != "ok" {
+		t.Errorf("reply:%x", reply)
+		return
+	}
+	//address encode
+	if len(socksAddr(nil, 0)) != 7 || len(socksAddr(net.ParseIP("::1"), 0)) != 19 {
+		t.Error("error")
+		return
+	}
+}
+
+func TestSocksProxyBind(t *testing.T) {
+	proxy := NewSocksProxy()
+	request := func(cmd byte) (conn *PipedConn, reply []byte, err error) {
+		conn, conb, _ := CreatePipeConn()
+		go proxy.procConn(conb)
+		conn.Write([]byte{0x05, 0x01, 0x00})
+		reply = make([]byte, 10)
+		err = fullBuf(conn, reply, 2)
+		if err == nil {
+			conn.Write([]byte{0x05, cmd, 0x00, 0x01, 127, 0, 0, 1, 0x00, 0x00})
+			err = fullBuf(conn, reply, 10)
+		}
+		return
+	}
+	//unknown command
+	conn, reply, err := request(0x09)
+	if err != nil || reply[1] != 0x07 {
+		t.Errorf("err:%v,reply:%x", err, reply)
+		return
+	}
+	conn.Close()
+	//bind
+	conn, reply, err = request(0x02)
+	if err != nil || reply[1] != 0x00 {
+		t.Errorf("err:%v,reply:%x", err, reply)
+		return
+	}
+	port := int(reply[8])*256 + int(reply[9])
+	peer, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%v", port))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = fullBuf(conn, reply, 10)
+	if err != nil || reply[1] != 0x00 || !net.IP(reply[4:8]).Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("err:%v,reply:%x", err, reply)
+		return
+	}
+	peer.Write([]byte("abc"))
+	err = fullBuf(conn, reply, 3)
+	if err != nil || string(reply[:3]) != "abc" {
+		t.Errorf("err:%v,reply:%x", err, reply)
+		return
+	}
+	conn.Write([]byte("123"))
+	err = fullBuf(peer, reply, 3)
+	if err != nil || string(reply[:3]) != "123" {
+		t.Errorf("err:%v,reply:%x", err, reply)
+		return
+	}
+	peer.Close()
+	conn.Close()
+	//timeout
+	proxy.BindTimeout = 100 * time.Millisecond
+	conn, reply, err = request(0x02)
+	if err != nil || reply[1] != 0x00 {
+		t.Errorf("err:%v,reply:%x", err, reply)
+		return
+	}
+	err = fullBuf(conn, reply, 10)
+	if err != nil || reply[1] != 0x06 {
+		t.Errorf("err:%v,reply:%x", err, reply)
+		return
+	}
+	conn.Close()
+}
+
+type timeoutErr struct{}
+
+func (t *timeoutErr) Error() string   { return "timeout" }
+func (t *timeoutErr) Timeout() bool   { return true }
+func (t *timeoutErr) Temporary() bool { return true }
+
 func TestFullBuf(t *testing.T) {
 	wait := make(chan int, 1)
 	r, w, _ := CreatePipeConn()
@@ -0,0 +1,279 @@
+package webdebugger
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"sync"
+)
+
+//socksUDPMaxRoutes is the max destination count of one udp associate
+const socksUDPMaxRoutes = 256
+
+//socksUDPRelay is the relay of socks5 udp associate, it will be closed when the control connection is closed
+type socksUDPRelay struct {
+	*net.UDPConn
+	control net.Conn
+	client  *net.UDPAddr
+	routes  map[string]*socksUDPRoute
+	proc    func(uri string) (target string, err error)
+	lck     sync.RWMutex
+}
+
+//socksUDPRoute is the connected udp socket to the target of destination uri,
+//the reply is received on it, so the reply is wrapped by uri even if other uri is routed to same target
+type socksUDPRoute struct {
+	*net.UDPConn
+	uri string
+}
+
+//procUDP will proc the udp associate command on control connection, the uri is the address client expected to send from
+func (s *SocksProxy) procUDP(control net.Conn, uri string) (err error) {
+	localIP := net.IPv4zero
+	if local, ok := control.LocalAddr().(*net.TCPAddr); ok {
+		localIP = local.IP
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: localIP})
+	if err != nil {
+		control.Write(socksReply(replyCode(err), nil))
+		return
+	}
+	relay := &socksUDPRelay{
+		UDPConn: conn,
+		control: control,
+		routes:  map[string]*socksUDPRoute{},
+		proc:    s.ProcUDP,
+		lck:     sync.RWMutex{},
+	}
+	relay.client = relay.expectClient(uri)
+	bound := &net.UDPAddr{IP: localIP, Port: conn.LocalAddr().(*net.UDPAddr).Port}
+	_, err = control.Write(socksReply(0x00, bound))
+	if err != nil {
+		conn.Close()
+		return
+	}
+	InfoLog("SocksProxy start udp relay on %v for %v", conn.LocalAddr(), control.RemoteAddr())
+	go relay.loopRead()
+	_, err = io.Copy(ioutil.Discard, control)
+	relay.Close()
+	InfoLog("SocksProxy udp relay on %v for %v is done", conn.LocalAddr(), control.RemoteAddr())
+	return
+}
+
+//Close will close the relay and all route
+func (s *socksUDPRelay) Close() (err error) {
+	err = s.UDPConn.Close()
+	s.lck.Lock()
+	for _, route := range s.routes {
+		if route != nil {
+			route.Close()
+		}
+	}
+	s.routes = nil
+	s.lck.Unlock()
+	return
+}
+
+//expectClient will return the client address by request, it return nil when the address should be learned by first packet
+func (s *socksUDPRelay) expectClient(uri string) (client *net.UDPAddr) {
+	_, port, err := net.SplitHostPort(uri)
+	if err != nil || port == "0" {
+		return
+	}
+	client, err = net.ResolveUDPAddr("udp", uri)
+	if err != nil {
+		client = nil
+		return
+	}
+	if client.IP == nil || client.IP.IsUnspecified() {
+		if remote, ok := s.control.RemoteAddr().(*net.TCPAddr); ok {
+			client.IP = remote.IP
+		} else {
+			client = nil
+		}
+	}
+	return
+}
+
+func (s *socksUDPRelay) isClient(from *net.UDPAddr) bool {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	if s.client != nil {
+		return s.client.IP.Equal(from.IP) && s.client.Port == from.Port
+	}
+	remote, ok := s.control.RemoteAddr().(*net.TCPAddr)
+	if !ok || remote.IP.Equal(from.IP) {
+		s.client = from
+		return true
+	}
+	return false
+}
+
+func (s *socksUDPRelay) loopRead() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, from, err := s.ReadFromUDP(buf)
+		if err != nil {
+			break
+		}
+		if s.isClient(from) {
+			err = s.procRequest(buf[:n])
+		} else {
+			err = fmt.Errorf("unknown source")
+		}
+		if err != nil {
+			DebugLog("SocksProxy udp relay on %v proc packet from %v fail with %v", s.LocalAddr(), from, err)
+		}
+	}
+	s.control.Close()
+}
+
+func (s *socksUDPRelay) procRequest(packet []byte) (err error) {
+	uri, data, err := parseSocksUDP(packet)
+	if err != nil {
+		return
+	}
+	s.lck.Lock()
+	if s.routes == nil {
+		s.lck.Unlock()
+		err = fmt.Errorf("relay is closed")
+		return
+	}
+	route, found := s.routes[uri]
+	if !found {
+		if len(s.routes) >= socksUDPMaxRoutes {
+			s.lck.Unlock()
+			err = fmt.Errorf("too many destination on relay")
+			return
+		}
+		s.routes[uri] = nil //resolving
+	}
+	s.lck.Unlock()
+	switch {
+	case !found:
+		go s.procRoute(uri, append([]byte{}, data...))
+	case route == nil:
+		err = fmt.Errorf("the route to %v is resolving", uri)
+	default:
+		_, err = route.Write(data)
+	}
+	return
+}
+
+//procRoute will create the route to uri and send the first packet, then relay the reply to client until the route is closed,
+//it is not running in read loop because the resolving may be slow
+func (s *socksUDPRelay) procRoute(uri string, data []byte) {
+	route, err := s.dialRoute(uri)
+	s.lck.Lock()
+	if err == nil && s.routes == nil {
+		err = fmt.Errorf("relay is closed")
+	}
+	if err != nil {
+		delete(s.routes, uri)
+		s.lck.Unlock()
+		DebugLog("SocksProxy udp relay on %v route to %v fail with %v", s.LocalAddr(), uri, err)
+		return
+	}
+	s.routes[uri] = route
+	s.lck.Unlock()
+	defer route.Close()
+	route.Write(data)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := route.Read(buf)
+		if err != nil {
+			break
+		}
+		if err = s.procResponse(route.uri, buf[:n]); err != nil {
+			DebugLog("SocksProxy udp relay on %v proc reply from %v fail with %v", s.LocalAddr(), uri, err)
+		}
+	}
+}
+
+func (s *socksUDPRelay) dialRoute(uri string) (route *socksUDPRoute, err error) {
+	forward := uri
+	if s.proc != nil {
+		forward, err = s.proc(uri)
+		if err != nil {
+			return
+		}
+	}
+	target, err := net.ResolveUDPAddr("udp", forward)
+	if err != nil {
+		return
+	}
+	conn, err := net.DialUDP("udp", nil, target)
+	if err == nil {
+		route = &socksUDPRoute{UDPConn: conn, uri: uri}
+	}
+	return
+}
+
+func (s *socksUDPRelay) procResponse(uri string, data []byte) (err error) {
+	s.lck.RLock()
+	client := s.client
+	s.lck.RUnlock()
+	if client == nil {
+		err = fmt.Errorf("unknown client")
+		return
+	}
+	host, port, _ := net.SplitHostPort(uri)
+	portNum, _ := strconv.Atoi(port)
+	var header []byte
+	if ip := net.ParseIP(host); ip != nil {
+		header = socksAddr(ip, portNum)
+	} else {
+		header = append([]byte{0x03, byte(len(host))}, []byte(host)...)
+		header = append(header, byte(portNum>>8), byte(portNum))
+	}
+	packet := append([]byte{0x00, 0x00, 0x00}, header...)
+	packet = append(packet, data...)
+	_, err = s.WriteToUDP(packet, client)
+	return
+}
+
+//parseSocksUDP will parse the socks5 udp request header
+func parseSocksUDP(packet []byte) (uri string, data []byte, err error) {
+	if len(packet) < 4 {
+		err = fmt.Errorf("packet is too short")
+		return
+	}
+	if packet[2] != 0x00 {
+		err = fmt.Errorf("fragmentation is not supported")
+		return
+	}
+	var host string
+	var offset int
+	switch packet[3] {
+	case 0x01:
+		offset = 4 + 4
+		if len(packet) >= offset+2 {
+			host = net.IP(packet[4:offset]).String()
+		}
+	case 0x03:
+		if len(packet) > 4 {
+			offset = 5 + int(packet[4])
+		}
+		if offset > 0 && len(packet) >= offset+2 {
+			host = string(packet[5:offset])
+		}
+	case 0x04:
+		offset = 4 + 16
+		if len(packet) >= offset+2 {
+			host = net.IP(packet[4:offset]).String()
+		}
+	default:
+		err = fmt.Errorf("ATYP %v is not supported", packet[3])
+		return
+	}
+	if len(host) < 1 {
+		err = fmt.Errorf("packet is too short")
+		return
+	}
+	port := uint16(packet[offset])*256 + uint16(packet[offset+1])
+	uri = net.JoinHostPort(host, fmt.Sprintf("%v", port))
+	data = packet[offset+2:]
+	return
+}
@@ -0,0 +1,103 @@
+package webdebugger
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSocksUDP(t *testing.T) {
+	echo, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer echo.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, from, err := echo.ReadFromUDP(buf)
+			if err != nil {
+				break
+			}
+			echo.WriteToUDP(buf[:n], from)
+		}
+	}()
+	echoAddr := echo.LocalAddr().(*net.UDPAddr)
+	debugger := NewDebuger(&Config{
+		Hosts: []*ConfigHost{
+			{Host: "echo.test:53", Forward: fmt.Sprintf("udp://%v", echoAddr)},
+		},
+	})
+	proxy := NewSocksProxy()
+	proxy.ProcUDP = debugger.ProcUDP
+	conn, conb, _ := CreatePipeConn()
+	go proxy.procConn(conb)
+	conn.Write([]byte{0x05, 0x01, 0x00})
+	reply := make([]byte, 10)
+	err = fullBuf(conn, reply, 2)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conn.Write([]byte{0x05, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	err = fullBuf(conn, reply, 10)
+	if err != nil || reply[1] != 0x00 {
+		t.Errorf("err:%v,reply:%x", err, reply)
+		return
+	}
+	relayPort := int(reply[8])*256 + int(reply[9])
+	client, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: relayPort})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer client.Close()
+	//direct
+	packet := append([]byte{0x00, 0x00, 0x00}, socksAddr(echoAddr.IP, echoAddr.Port)...)
+	client.Write(append(packet, []byte("abc")...))
+	buf := make([]byte, 1024)
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := client.Read(buf)
+	if err != nil || string(buf[10:n]) != "abc" || buf[3] != 0x01 {
+		t.Errorf("err:%v,buf:%x", err, buf[:n])
+		return
+	}
+	//forward by debugger
+	packet = []byte{0x00, 0x00, 0x00, 0x03, 9}
+	packet = append(packet, []byte("echo.test")...)
+	packet = append(packet, 0x00, 53)
+	client.Write(append(packet, []byte("123")...))
+	n, err = client.Read(buf)
+	if err != nil || string(buf[:n]) != string(append(packet, []byte("123")...)) {
+		t.Errorf("err:%v,buf:%x", err, buf[:n])
+		return
+	}
+	//direct to same target is not mixed with forward
+	client.Write(append(append([]byte{0x00, 0x00, 0x00}, socksAddr(echoAddr.IP, echoAddr.Port)...), []byte("xyz")...))
+	n, err = client.Read(buf)
+	if err != nil || string(buf[10:n]) != "xyz" || buf[3] != 0x01 {
+		t.Errorf("err:%v,buf:%x", err, buf[:n])
+		return
+	}
+	//fragmentation
+	client.Write([]byte{0x00, 0x00, 0x01, 0x01})
+	//close
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+	client.Write(append(packet, []byte("123")...))
+	client.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err = client.Read(buf)
+	if err == nil {
+		t.Error("relay is not closed")
+		return
+	}
+	//parse error
+	for _, p := range [][]byte{{0x00}, {0x00, 0x00, 0x00, 0x05}, {0x00, 0x00, 0x00, 0x01, 0x01}, {0x00, 0x00, 0x00, 0x03}, {0x00, 0x00, 0x00, 0x04, 0x01}} {
+		if _, _, err = parseSocksUDP(p); err == nil {
+			t.Errorf("packet %x", p)
+			return
+		}
+	}
+}
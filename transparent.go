@@ -0,0 +1,243 @@
+package webdebugger
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+//TransparentProxy is the proxy for iptables REDIRECT/TPROXY, it will peek the TLS ClientHello to find the SNI
+//and using SNI with the original destination port as uri to proc connection, the original destination is
+//found by OriginalDst for REDIRECT, or by the local address of connection for TPROXY.
+//
+//the listener is created with IP_TRANSPARENT when TProxy is true, it is supported on linux only and required CAP_NET_ADMIN
+type TransparentProxy struct {
+	net.Listener
+	ProcConn     func(uri string, raw net.Conn) (async bool, err error)
+	OriginalDst  func(conn net.Conn) (addr *net.TCPAddr, err error)
+	SniffTimeout time.Duration
+	TProxy       bool
+}
+
+//NewTransparentProxy will return new TransparentProxy
+func NewTransparentProxy() (proxy *TransparentProxy) {
+	proxy = &TransparentProxy{
+		OriginalDst:  originalDst,
+		SniffTimeout: 10 * time.Second,
+	}
+	return
+}
+
+//Listen the address
+func (t *TransparentProxy) Listen(addr string) (err error) {
+	config := &net.ListenConfig{}
+	if t.TProxy {
+		config.Control = transparentControl
+	}
+	t.Listener, err = config.Listen(context.Background(), "tcp", addr)
+	if err == nil {
+		InfoLog("TransparentProxy listen transparent proxy on %v by tproxy:%v", addr, t.TProxy)
+	}
+	return
+}
+
+//Run proxy listener
+func (t *TransparentProxy) Run() (err error) {
+	if t.Listener != nil {
+		t.loopAccept(t.Listener)
+	}
+	return
+}
+
+func (t *TransparentProxy) loopAccept(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			break
+		}
+		go t.ProcTLSConn(conn)
+	}
+}
+
+//ProcTLSConn will proc the redirected connection which is starting with TLS ClientHello
+func (t *TransparentProxy) ProcTLSConn(conn net.Conn) {
+	var err error
+	var async bool
+	DebugLog("TransparentProxy proxy connection from %v", conn.RemoteAddr())
+	defer func() {
+		if !async {
+			DebugLog("TransparentProxy proxy connection from %v is done with %v", conn.RemoteAddr(), err)
+			conn.Close()
+		}
+	}()
+	reader := bufio.NewReaderSize(conn, 5+16*1024)
+	conn.SetReadDeadline(time.Now().Add(t.SniffTimeout))
+	sni, err := peekClientHelloSNI(reader)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		WarnLog("TransparentProxy peek ClientHello from %v fail with %v", conn.RemoteAddr(), err)
+	}
+	var dst *net.TCPAddr
+	if t.TProxy {
+		//the TPROXY connection is accepted on the original destination address
+		dst, _ = conn.LocalAddr().(*net.TCPAddr)
+	} else if t.OriginalDst != nil {
+		dst, err = t.OriginalDst(conn)
+		if err != nil {
+			DebugLog("TransparentProxy get original destination on %v fail with %v", conn.RemoteAddr(), err)
+			dst = t.localDst(conn)
+		}
+	}
+	var uri string
+	switch {
+	case len(sni) > 0 && dst != nil:
+		uri = net.JoinHostPort(sni, strconv.Itoa(dst.Port))
+	case len(sni) > 0:
+		uri = net.JoinHostPort(sni, "443")
+	case dst != nil:
+		uri = dst.String()
+	default:
+		err = fmt.Errorf("not sni and original destination found")
+		return
+	}
+	DebugLog("TransparentProxy start proc %v on %v by sni:%v,dst:%v", uri, conn.RemoteAddr(), sni, dst)
+	async, err = t.ProcConn(uri, &bufferedConn{Conn: conn, Reader: reader})
+}
+
+//localDst will return the local address of connection as original destination when it is not the listener address,
+//the TPROXY connection is accepted on the original destination address
+func (t *TransparentProxy) localDst(conn net.Conn) (addr *net.TCPAddr) {
+	if t.Listener == nil {
+		return
+	}
+	listen, _ := t.Listener.Addr().(*net.TCPAddr)
+	local, _ := conn.LocalAddr().(*net.TCPAddr)
+	if listen == nil || local == nil {
+		return
+	}
+	if local.Port == listen.Port && (listen.IP.IsUnspecified() || listen.IP.Equal(local.IP)) {
+		return
+	}
+	addr = local
+	return
+}
+
+//peekClientHelloSNI will peek the TLS ClientHello record and return the server name
+func peekClientHelloSNI(reader *bufio.Reader) (sni string, err error) {
+	header, err := reader.Peek(5)
+	if err != nil {
+		return
+	}
+	if header[0] != 0x16 {
+		err = fmt.Errorf("not TLS handshake record by %x", header[0])
+		return
+	}
+	length := int(header[3])<<8 | int(header[4])
+	record, err := reader.Peek(5 + length)
+	if err != nil {
+		return
+	}
+	sni, err = parseClientHelloSNI(record[5:])
+	return
+}
+
+//parseClientHelloSNI will parse the server name extension from the ClientHello handshake message
+func parseClientHelloSNI(data []byte) (sni string, err error) {
+	err = fmt.Errorf("invalid ClientHello")
+	if len(data) < 4 || data[0] != 0x01 {
+		return
+	}
+	data = data[4:]
+	//version(2) + random(32)
+	if len(data) < 34 {
+		return
+	}
+	data = data[34:]
+	//session id
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return
+	}
+	data = data[1+int(data[0]):]
+	//cipher suites
+	if len(data) < 2 {
+		return
+	}
+	n := int(data[0])<<8 | int(data[1])
+	if len(data) < 2+n {
+		return
+	}
+	data = data[2+n:]
+	//compression methods
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return
+	}
+	data = data[1+int(data[0]):]
+	err = nil
+	//extensions
+	if len(data) < 2 {
+		return
+	}
+	n = int(data[0])<<8 | int(data[1])
+	data = data[2:]
+	if len(data) > n {
+		data = data[:n]
+	}
+	for len(data) >= 4 {
+		extType := int(data[0])<<8 | int(data[1])
+		extLen := int(data[2])<<8 | int(data[3])
+		data = data[4:]
+		if len(data) < extLen {
+			err = fmt.Errorf("invalid ClientHello extension")
+			return
+		}
+		if extType == 0x00 {
+			sni, err = parseServerNameExt(data[:extLen])
+			return
+		}
+		data = data[extLen:]
+	}
+	return
+}
+
+func parseServerNameExt(data []byte) (sni string, err error) {
+	if len(data) < 2 {
+		err = fmt.Errorf("invalid server name extension")
+		return
+	}
+	data = data[2:]
+	for len(data) >= 3 {
+		nameType := data[0]
+		nameLen := int(data[1])<<8 | int(data[2])
+		data = data[3:]
+		if len(data) < nameLen {
+			break
+		}
+		if nameType == 0x00 {
+			sni = string(data[:nameLen])
+			return
+		}
+		data = data[nameLen:]
+	}
+	err = fmt.Errorf("invalid server name extension")
+	return
+}
+
+//rawTCPConn will return the wrapped *net.TCPConn
+func rawTCPConn(conn net.Conn) (tcp *net.TCPConn, ok bool) {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			tcp, ok = c, true
+			return
+		case *bufferedConn:
+			conn = c.Conn
+		case *StringConn:
+			conn = c.Conn
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package webdebugger
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+//soOriginalDst is SO_ORIGINAL_DST and IP6T_SO_ORIGINAL_DST in linux/netfilter_ipv4.h
+const soOriginalDst = 80
+
+//ipv6Transparent is IPV6_TRANSPARENT in linux/in6.h
+const ipv6Transparent = 75
+
+//transparentControl will set IP_TRANSPARENT/IPV6_TRANSPARENT on listener socket for iptables TPROXY
+func transparentControl(network, address string, c syscall.RawConn) (err error) {
+	var xerr error
+	err = c.Control(func(fd uintptr) {
+		if network == "tcp6" {
+			//the dual stack socket is accepting ipv4 also, so the IP_TRANSPARENT is setted without checking
+			syscall.SetsockoptInt(int(fd), syscall.SOL_IP, syscall.IP_TRANSPARENT, 1)
+			xerr = syscall.SetsockoptInt(int(fd), syscall.SOL_IPV6, ipv6Transparent, 1)
+			return
+		}
+		xerr = syscall.SetsockoptInt(int(fd), syscall.SOL_IP, syscall.IP_TRANSPARENT, 1)
+	})
+	if err == nil {
+		err = xerr
+	}
+	return
+}
+
+//originalDst will return the original destination of iptables REDIRECT/TPROXY connection by SO_ORIGINAL_DST
+func originalDst(conn net.Conn) (addr *net.TCPAddr, err error) {
+	tcp, ok := rawTCPConn(conn)
+	if !ok {
+		err = fmt.Errorf("not tcp connection")
+		return
+	}
+	raw, err := tcp.SyscallConn()
+	if err != nil {
+		return
+	}
+	local, _ := tcp.LocalAddr().(*net.TCPAddr)
+	ipv4 := local == nil || local.IP.To4() != nil
+	var xerr error
+	err = raw.Control(func(fd uintptr) {
+		if ipv4 {
+			//the sockaddr_in is returned in IPv6Mreq buffer
+			var mreq *syscall.IPv6Mreq
+			mreq, xerr = syscall.GetsockoptIPv6Mreq(int(fd), syscall.SOL_IP, soOriginalDst)
+			if xerr == nil {
+				addr = &net.TCPAddr{
+					IP:   net.IPv4(mreq.Multiaddr[4], mreq.Multiaddr[5], mreq.Multiaddr[6], mreq.Multiaddr[7]),
+					Port: int(mreq.Multiaddr[2])<<8 | int(mreq.Multiaddr[3]),
+				}
+			}
+		} else {
+			//the sockaddr_in6 is returned in IPv6MTUInfo buffer
+			var info *syscall.IPv6MTUInfo
+			info, xerr = syscall.GetsockoptIPv6MTUInfo(int(fd), syscall.SOL_IPV6, soOriginalDst)
+			if xerr == nil {
+				port := (*[2]byte)(unsafe.Pointer(&info.Addr.Port))
+				addr = &net.TCPAddr{
+					IP:   net.IP(append([]byte{}, info.Addr.Addr[:]...)),
+					Port: int(port[0])<<8 | int(port[1]),
+				}
+			}
+		}
+	})
+	if err == nil {
+		err = xerr
+	}
+	return
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package webdebugger
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"syscall"
+)
+
+//originalDst is not supported on this platform, the SNI with 443 port will be used
+func originalDst(conn net.Conn) (addr *net.TCPAddr, err error) {
+	err = fmt.Errorf("original destination is not supported on %v", runtime.GOOS)
+	return
+}
+
+//transparentControl is not supported on this platform, TPROXY is linux only
+func transparentControl(network, address string, c syscall.RawConn) (err error) {
+	err = fmt.Errorf("tproxy is not supported on %v", runtime.GOOS)
+	return
+}
@@ -0,0 +1,170 @@
+package webdebugger
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func clientHello(serverName string) (hello []byte) {
+	a, b := net.Pipe()
+	go func() {
+		conn := tls.Client(a, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+		conn.Handshake()
+	}()
+	buf := make([]byte, 5)
+	fullBuf(b, buf, 5)
+	length := int(buf[3])<<8 | int(buf[4])
+	hello = make([]byte, 5+length)
+	copy(hello, buf)
+	fullBuf(b, hello[5:], uint32(length))
+	a.Close()
+	b.Close()
+	return
+}
+
+func TestTransparentProxy(t *testing.T) {
+	proxy := NewTransparentProxy()
+	var target string
+	var received []byte
+	proxy.ProcConn = func(uri string, raw net.Conn) (async bool, err error) {
+		target = uri
+		received = make([]byte, 5)
+		err = fullBuf(raw, received, 5)
+		return
+	}
+	var local net.Addr
+	proc := func(hello []byte, dst *net.TCPAddr) {
+		target, received = "", nil
+		proxy.OriginalDst = func(conn net.Conn) (addr *net.TCPAddr, err error) {
+			if dst == nil {
+				err = fmt.Errorf("not found")
+			}
+			addr = dst
+			return
+		}
+		conn, conb, _ := CreatePipeConn()
+		go func() {
+			conn.Write(hello)
+			conn.Close()
+		}()
+		if local != nil {
+			proxy.ProcTLSConn(&localAddrConn{Conn: conb, local: local})
+		} else {
+			proxy.ProcTLSConn(conb)
+		}
+	}
+	hello := clientHello("wdebugger.snows.io")
+	//sni and dst
+	proc(hello, &net.TCPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 8443})
+	if target != "wdebugger.snows.io:8443" || !bytes.Equal(received, hello[:5]) {
+		t.Errorf("target:%v,received:%x", target, received)
+		return
+	}
+	//sni only
+	proc(hello, nil)
+	if target != "wdebugger.snows.io:443" {
+		t.Errorf("target:%v", target)
+		return
+	}
+	//dst only
+	proc(clientHello(""), &net.TCPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 8443})
+	if target != "1.2.3.4:8443" {
+		t.Errorf("target:%v", target)
+		return
+	}
+	//tproxy by local address
+	proxy.Listener, _ = net.Listen("tcp", "127.0.0.1:0")
+	local = &net.TCPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 8443}
+	proc(hello, nil)
+	if target != "wdebugger.snows.io:8443" {
+		t.Errorf("target:%v", target)
+		return
+	}
+	local = proxy.Listener.Addr()
+	proc(hello, nil)
+	if target != "wdebugger.snows.io:443" {
+		t.Errorf("target:%v", target)
+		return
+	}
+	proxy.Listener.Close()
+	proxy.Listener, local = nil, nil
+	//tproxy
+	proxy.TProxy = true
+	local = &net.TCPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 8443}
+	proc(hello, &net.TCPAddr{IP: net.IPv4(5, 6, 7, 8), Port: 9})
+	if target != "wdebugger.snows.io:8443" {
+		t.Errorf("target:%v", target)
+		return
+	}
+	err := proxy.Listen("127.0.0.1:0")
+	if runtime.GOOS == "linux" && os.Geteuid() == 0 && err != nil {
+		t.Error(err)
+		return
+	}
+	if err == nil {
+		proxy.Close()
+	}
+	proxy.TProxy, local = false, nil
+	//not found
+	proc([]byte{0x00}, nil)
+	if len(target) > 0 {
+		t.Errorf("target:%v", target)
+		return
+	}
+	//parse error
+	for _, data := range [][]byte{{0x02}, {0x01, 0, 0, 0}, hello[5:50], hello[5:80]} {
+		if _, err := parseClientHelloSNI(data); err == nil {
+			t.Errorf("data:%x", data)
+			return
+		}
+	}
+	if _, err := peekClientHelloSNI(bufio.NewReader(bytes.NewBuffer([]byte{0x17, 0, 0, 0, 0}))); err == nil {
+		t.Error("error")
+		return
+	}
+	if _, err := parseServerNameExt([]byte{0x00}); err == nil {
+		t.Error("error")
+		return
+	}
+	if _, err := parseServerNameExt([]byte{0x00, 0x04, 0x01, 0x00, 0x01, 'a'}); err == nil {
+		t.Error("error")
+		return
+	}
+	//listen
+	err = proxy.Listen("127.0.0.1:10051")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	go proxy.Run()
+	proxy.OriginalDst = originalDst
+	conn, err := net.Dial("tcp", "127.0.0.1:10051")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conn.Write(hello)
+	time.Sleep(100 * time.Millisecond)
+	conn.Close()
+	proxy.Close()
+	if _, err = originalDst(&PipedConn{}); err == nil {
+		t.Error("error")
+		return
+	}
+}
+
+type localAddrConn struct {
+	net.Conn
+	local net.Addr
+}
+
+func (l *localAddrConn) LocalAddr() net.Addr {
+	return l.local
+}
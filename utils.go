@@ -10,6 +10,8 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/net/websocket"
@@ -212,15 +214,48 @@ func (ln TCPKeepAliveListener) Accept() (net.Conn, error) {
 }
 
 func httpGet(url, username, password string) (data []byte, err error) {
+	_, _, data, err = httpGetHeader(nil, url, username, password, nil)
+	return
+}
+
+//httpGetHeader will send get request with header by client and return the response status/header/body,
+//the http.DefaultClient is used when client is nil
+func httpGetHeader(client *http.Client, url, username, password string, header http.Header) (status int, respHeader http.Header, data []byte, err error) {
 	req, err := http.NewRequest("GET", url, nil)
-	if err == nil {
-		if len(username) > 0 {
-			req.SetBasicAuth(username, password)
-		}
-		var resp *http.Response
-		resp, err = http.DefaultClient.Do(req)
-		if err == nil {
-			data, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if len(username) > 0 {
+		req.SetBasicAuth(username, password)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	status, respHeader = resp.StatusCode, resp.Header
+	data, err = ioutil.ReadAll(resp.Body)
+	return
+}
+
+//parseMaxAge will return the max-age of Cache-Control header, it return 0 when no-cache/no-store or not found
+func parseMaxAge(header http.Header) (maxAge time.Duration) {
+	for _, part := range strings.Split(header.Get("Cache-Control"), ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		switch {
+		case part == "no-cache" || part == "no-store":
+			return 0
+		case strings.HasPrefix(part, "max-age="):
+			seconds, err := strconv.Atoi(strings.TrimPrefix(part, "max-age="))
+			if err == nil && seconds > 0 {
+				maxAge = time.Duration(seconds) * time.Second
+			}
 		}
 	}
 	return
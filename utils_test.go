@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"os"
 	"sync"
 	"testing"
@@ -144,3 +145,19 @@ func TestReadJSON(t *testing.T) {
 		return
 	}
 }
+
+func TestParseMaxAge(t *testing.T) {
+	for value, maxAge := range map[string]time.Duration{
+		"":                    0,
+		"max-age=60":          time.Minute,
+		"private, max-age=10": 10 * time.Second,
+		"no-cache":            0,
+		"max-age=60,no-store": 0,
+		"max-age=xx":          0,
+	} {
+		if v := parseMaxAge(http.Header{"Cache-Control": {value}}); v != maxAge {
+			t.Errorf("%v->%v", value, v)
+			return
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sutils/webdebugger"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var caCertFile = filepath.Join(workDir, "ca.crt")
+var caKeyFile = filepath.Join(workDir, "ca.key")
+
+//runCA will create root CA in workDir when it is not exists and export it by PEM/DER/PKCS#12
+func runCA(args []string) (err error) {
+	var out, password, name string
+	var renew bool
+	flags := flag.NewFlagSet("ca", flag.ContinueOnError)
+	flags.StringVar(&out, "o", workDir, "the directory to export CA certificate")
+	flags.StringVar(&password, "password", "", "the password of PKCS#12 file")
+	flags.StringVar(&name, "name", "Web Debugger Root CA", "the common name of new root CA")
+	flags.BoolVar(&renew, "new", false, "create new root CA even if it is exists")
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+	var ca *webdebugger.CertAuthority
+	if _, xerr := os.Stat(caCertFile); renew || os.IsNotExist(xerr) {
+		ca, err = webdebugger.GenerateCA(name)
+		if err == nil {
+			err = ca.Save(caCertFile, caKeyFile)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "create root CA fail with %v\n", err)
+			return
+		}
+		fmt.Printf("Create root CA to %v\n", caCertFile)
+	} else {
+		ca, err = webdebugger.LoadCA(caCertFile, caKeyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "load root CA from %v fail with %v\n", caCertFile, err)
+			return
+		}
+		fmt.Printf("Using root CA from %v\n", caCertFile)
+	}
+	p12, err := pkcs12.LegacyDES.EncodeTrustStore([]*x509.Certificate{ca.Cert}, password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "encode PKCS#12 fail with %v\n", err)
+		return
+	}
+	os.MkdirAll(out, os.ModePerm)
+	exports := map[string][]byte{
+		"ca-cert.pem": ca.CertPEM,
+		"ca-cert.cer": ca.Cert.Raw,
+		"ca-cert.p12": p12,
+	}
+	for file, data := range exports {
+		file = filepath.Join(out, file)
+		err = ioutil.WriteFile(file, data, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "export to %v fail with %v\n", file, err)
+			return
+		}
+	}
+	sha256Value, sha1Value := ca.Fingerprint()
+	fmt.Printf("Subject: %v\n", ca.Cert.Subject)
+	fmt.Printf("NotAfter: %v\n", ca.Cert.NotAfter)
+	fmt.Printf("SHA256 Fingerprint: %v\n", sha256Value)
+	fmt.Printf("SHA1 Fingerprint: %v\n", sha1Value)
+	fmt.Printf("Export PEM to %v\n", filepath.Join(out, "ca-cert.pem"))
+	fmt.Printf("Export DER to %v\n", filepath.Join(out, "ca-cert.cer"))
+	fmt.Printf("Export PKCS#12 to %v\n", filepath.Join(out, "ca-cert.p12"))
+	return
+}
@@ -2,34 +2,18 @@ package main
 
 import (
 	"os"
-	"os/exec"
 	"os/signal"
-	"path/filepath"
+	"syscall"
 
 	"github.com/sutils/webdebugger"
 )
 
-var privoxyRunner *exec.Cmd
-var privoxyPath = filepath.Join(execDir(), "privoxy")
-
-func runPrivoxyNative(conf string) (err error) {
-	privoxyRunner = exec.Command(privoxyPath, "--no-daemon", conf)
-	privoxyRunner.Stderr = os.Stdout
-	privoxyRunner.Stdout = os.Stderr
-	err = privoxyRunner.Start()
-	if err == nil {
-		err = privoxyRunner.Wait()
-	}
-	privoxyRunner = nil
-	return
-}
-
 var clientKillSignal chan os.Signal
 
 func handlerClientKill() {
 	clientKillSignal = make(chan os.Signal, 1000)
-	// signal.Notify(clientKillSignal, os.Kill, os.Interrupt)
-	signal.Notify(clientKillSignal)
+	//only the terminating signal, the SIGURG is used by go runtime for preemption
+	signal.Notify(clientKillSignal, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
 	v := <-clientKillSignal
 	webdebugger.WarnLog("Clien receive kill signal:%v", v)
 	stopClient()
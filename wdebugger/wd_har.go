@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sutils/webdebugger"
+)
+
+//runExportHAR will export the latest exchange which is captured to directory as HAR file
+func runExportHAR(args []string) (err error) {
+	var dir, output string
+	var size int
+	flags := flag.NewFlagSet("export-har", flag.ContinueOnError)
+	flags.StringVar(&dir, "d", "", "the capture directory which is configured by capture.dir")
+	flags.StringVar(&output, "o", "", "the output HAR file, default is stdout")
+	flags.IntVar(&size, "n", 1000, "the max count of latest exchange to export")
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+	if len(dir) < 1 {
+		err = fmt.Errorf("capture directory is required")
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		flags.Usage()
+		return
+	}
+	if _, err = os.Stat(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "read capture directory fail with %v\n", err)
+		return
+	}
+	store := webdebugger.NewCaptureStore(&webdebugger.CaptureConfig{Dir: dir, Size: size})
+	out := os.Stdout
+	if len(output) > 0 {
+		out, err = os.Create(output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "create %v fail with %v\n", output, err)
+			return
+		}
+		defer out.Close()
+	}
+	err = webdebugger.WriteHAR(out, store.List())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "write HAR fail with %v\n", err)
+	}
+	return
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sutils/webdebugger"
+)
+
+var hashInput = os.Stdin
+
+//runHashPassword will print the hash of password for configure, the password is read from stdin when it is not in args,
+//and new bearer token is created and printed with the digest by HashToken when -token is setted
+func runHashPassword(args []string) (err error) {
+	var algorithm string
+	var token bool
+	flags := flag.NewFlagSet("hash-password", flag.ContinueOnError)
+	flags.StringVar(&algorithm, "a", webdebugger.HashBcrypt, "the hash algorithm in bcrypt/argon2id/sha1")
+	flags.BoolVar(&token, "token", false, "create new bearer token and print the token with sha256 digest")
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+	password := flags.Arg(0)
+	if token {
+		password, err = webdebugger.NewToken()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "create token fail with %v\n", err)
+			return
+		}
+	} else if len(password) < 1 {
+		fmt.Fprintf(os.Stderr, "Password:")
+		password, err = bufio.NewReader(hashInput).ReadString('\n')
+		password = strings.TrimRight(password, "\r\n")
+		if len(password) < 1 {
+			err = fmt.Errorf("password is empty")
+			fmt.Fprintf(os.Stderr, "read password fail with %v\n", err)
+			return
+		}
+		err = nil
+	}
+	if token {
+		fmt.Printf("Token: %v\n", password)
+		fmt.Printf("Hash: %v\n", webdebugger.HashToken(password))
+		return
+	}
+	hash, err := webdebugger.HashPassword(algorithm, password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hash password fail with %v\n", err)
+		return
+	}
+	fmt.Println(hash)
+	return
+}
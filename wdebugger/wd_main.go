@@ -21,6 +21,30 @@ func init() {
 func main() {
 	log.SetFlags(log.Lshortfile | log.Ldate | log.Lmicroseconds)
 	log.SetOutput(os.Stdout)
+	if flag.Arg(0) == "ca" {
+		if runCA(flag.Args()[1:]) != nil {
+			exitf(1)
+		}
+		return
+	}
+	if flag.Arg(0) == "hash-password" {
+		if runHashPassword(flag.Args()[1:]) != nil {
+			exitf(1)
+		}
+		return
+	}
+	if flag.Arg(0) == "export-har" {
+		if runExportHAR(flag.Args()[1:]) != nil {
+			exitf(1)
+		}
+		return
+	}
+	if flag.Arg(0) == "replay" {
+		if runReplay(flag.Args()[1:]) != nil {
+			exitf(1)
+		}
+		return
+	}
 	if argRunServer {
 		startServer(argConf)
 	} else if argRunProxy {
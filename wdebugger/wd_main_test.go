@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"crypto/tls"
 	"fmt"
 	"io/ioutil"
@@ -8,24 +9,18 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
-	"runtime"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/sutils/webdebugger"
+	"software.sslmate.com/src/go-pkcs12"
 )
 
 func init() {
 	log.SetFlags(log.Lshortfile | log.Ldate | log.Lmicroseconds)
 	log.SetOutput(os.Stdout)
-	privoxyPath = "./privoxy"
-	switch runtime.GOOS {
-	case "darwin":
-		exec.Command("cp", "-f", "../privoxy-Darwin", "privoxy").CombinedOutput()
-	case "linux":
-		exec.Command("cp", "-f", "../privoxy-Linux", "privoxy").CombinedOutput()
-	default:
-		exec.Command("powershell", "cp", "..\\privoxy-Win.exe", "privoxy.exe").CombinedOutput()
-	}
 }
 
 func TestMain(t *testing.T) {
@@ -58,6 +53,124 @@ func TestMain(t *testing.T) {
 		t.Errorf("err:%v,resp:%v", err, resp)
 		return
 	}
+	for _, proxy := range []string{"http://127.0.0.1:10202", "socks5://127.0.0.1:10202"} {
+		proxyURL, _ = url.Parse(proxy)
+		client = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyURL(proxyURL),
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		}
+		resp, err = doGet(client, "https://wdebugger.snows.io")
+		if err != nil || resp != "ok" {
+			t.Errorf("proxy:%v,err:%v,resp:%v", proxy, err, resp)
+			return
+		}
+	}
+	//admin web ui
+	resp, err = doGet(http.DefaultClient, "http://127.0.0.1:10203/api/captures?host=wdebugger.snows.io")
+	if err != nil || !strings.Contains(resp, "wdebugger.snows.io") {
+		t.Errorf("err:%v,resp:%v", err, resp)
+		return
+	}
+	//replay
+	out := bytes.NewBuffer(nil)
+	replayOutput = out
+	defer func() {
+		replayOutput = os.Stdout
+	}()
+	err = runReplay([]string{"-s", "127.0.0.1:10203", "-H", "X-Test: 1", "1"})
+	if err != nil || !strings.Contains(out.String(), "#4 GET https://wdebugger.snows.io/ -> 200") || !strings.Contains(out.String(), "same") {
+		t.Errorf("err:%v,out:%v", err, out.String())
+		return
+	}
+	bodyFile := filepath.Join(os.TempDir(), "wdebugger-replay.txt")
+	ioutil.WriteFile(bodyFile, []byte("abc"), 0600)
+	defer os.Remove(bodyFile)
+	err = runReplay([]string{"-s", "http://127.0.0.1:10203/", "-X", "POST", "-d", "@" + bodyFile, "1"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	//replay error
+	for _, args := range [][]string{
+		{"-s", "127.0.0.1:10203", "xx"},
+		{"-s", "127.0.0.1:10203", "100"},
+		{"-s", "127.0.0.1:10203", "-H", "xx", "1"},
+		{"-s", "127.0.0.1:10203", "-d", "@/none/xx", "1"},
+		{"-s", "127.0.0.1:10", "1"},
+		{"-s", "127.0.0.1:10203"},
+		{"1"},
+		{"-xx"},
+	} {
+		if runReplay(args) == nil {
+			t.Errorf("args:%v", args)
+			return
+		}
+	}
+}
+
+func TestCA(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wdebugger")
+	defer os.RemoveAll(dir)
+	oldCertFile, oldKeyFile := caCertFile, caKeyFile
+	defer func() {
+		caCertFile, caKeyFile = oldCertFile, oldKeyFile
+	}()
+	caCertFile, caKeyFile = filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	err := runCA([]string{"-o", dir, "-password", "123"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ca, err := webdebugger.LoadCA(caCertFile, caKeyFile)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	p12, _ := ioutil.ReadFile(filepath.Join(dir, "ca-cert.p12"))
+	certs, err := pkcs12.DecodeTrustStore(p12, "123")
+	if err != nil || len(certs) != 1 || !certs[0].Equal(ca.Cert) {
+		t.Errorf("err:%v", err)
+		return
+	}
+	der, _ := ioutil.ReadFile(filepath.Join(dir, "ca-cert.cer"))
+	if !bytes.Equal(der, ca.Cert.Raw) {
+		t.Error("error")
+		return
+	}
+	//reuse
+	err = runCA([]string{"-o", dir})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	reused, _ := webdebugger.LoadCA(caCertFile, caKeyFile)
+	if !reused.Cert.Equal(ca.Cert) {
+		t.Error("error")
+		return
+	}
+	//new
+	err = runCA([]string{"-o", dir, "-new", "-name", "Test CA"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	renewed, _ := webdebugger.LoadCA(caCertFile, caKeyFile)
+	if renewed.Cert.Equal(ca.Cert) || renewed.Cert.Subject.CommonName != "Test CA" {
+		t.Error("error")
+		return
+	}
+	//error
+	if runCA([]string{"-xx"}) == nil {
+		t.Error("error")
+		return
+	}
+	ioutil.WriteFile(caKeyFile, []byte("xx"), 0600)
+	if runCA([]string{"-o", dir}) == nil {
+		t.Error("error")
+		return
+	}
 }
 
 func doGet(client *http.Client, url string) (data string, err error) {
@@ -73,3 +186,153 @@ func doGet(client *http.Client, url string) (data string, err error) {
 	}
 	return
 }
+
+func TestHashPassword(t *testing.T) {
+	err := runHashPassword([]string{"-a", "sha1", "123"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = runHashPassword([]string{"-token"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	//stdin
+	r, w, _ := os.Pipe()
+	hashInput = r
+	defer func() {
+		hashInput = os.Stdin
+	}()
+	w.Write([]byte("123\n\n"))
+	w.Close()
+	err = runHashPassword([]string{"-a", "argon2id"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	//error
+	err = runHashPassword([]string{})
+	if err == nil {
+		t.Error("error")
+		return
+	}
+	err = runHashPassword([]string{"-a", "xx", "123"})
+	if err == nil {
+		t.Error("error")
+		return
+	}
+	err = runHashPassword([]string{"-xx"})
+	if err == nil {
+		t.Error("error")
+		return
+	}
+}
+
+func TestExportHAR(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wdebugger")
+	defer os.RemoveAll(dir)
+	store := webdebugger.NewCaptureStore(&webdebugger.CaptureConfig{Dir: dir})
+	store.Add(&webdebugger.CaptureEntry{Request: &webdebugger.CaptureMessage{}, Response: &webdebugger.CaptureMessage{}})
+	output := filepath.Join(dir, "out.har")
+	err := runExportHAR([]string{"-d", dir, "-o", output})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	har := &webdebugger.HAR{}
+	err = webdebugger.ReadJSON(output, har)
+	if err != nil || len(har.Log.Entries) != 1 {
+		t.Errorf("err:%v", err)
+		return
+	}
+	//error
+	if runExportHAR([]string{}) == nil {
+		t.Error("error")
+		return
+	}
+	if runExportHAR([]string{"-d", filepath.Join(dir, "xx")}) == nil {
+		t.Error("error")
+		return
+	}
+	if runExportHAR([]string{"-d", dir, "-o", filepath.Join(dir, "xx", "out.har")}) == nil {
+		t.Error("error")
+		return
+	}
+	if runExportHAR([]string{"-xx"}) == nil {
+		t.Error("error")
+		return
+	}
+}
+
+func TestSaveServerCerts(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wdebugger")
+	defer os.RemoveAll(dir)
+	oldConf := serverConf
+	defer func() {
+		serverConf = oldConf
+	}()
+	serverConf = filepath.Join(dir, "wdebugger-s.json")
+	ioutil.WriteFile(serverConf, []byte(`{"listen":":10020","certs":[]}`), 0600)
+	err := saveServerCerts([]map[string]interface{}{{"host": "a.snows.io:443"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conf := &ServerConf{}
+	webdebugger.ReadJSON(serverConf, conf)
+	if conf.Listen != ":10020" || len(conf.Certs) != 1 || conf.Certs[0]["host"] != "a.snows.io:443" {
+		t.Errorf("conf:%v", conf)
+		return
+	}
+	//error
+	serverConf = filepath.Join(dir, "xx.json")
+	if saveServerCerts(nil) == nil {
+		t.Error("error")
+		return
+	}
+}
+
+func TestServerClientCA(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wdebugger")
+	defer os.RemoveAll(dir)
+	code := 0
+	exitf = func(c int) {
+		code = c
+	}
+	defer func() {
+		exitf = os.Exit
+	}()
+	conf := filepath.Join(dir, "wdebugger-s.json")
+	ioutil.WriteFile(conf, []byte(`{"listen":":10022","client_ca":"ca.crt","certs":[]}`), 0600)
+	startServer(conf)
+	if code != 1 {
+		t.Errorf("code:%v", code)
+		return
+	}
+}
+
+func TestAdminListenAddr(t *testing.T) {
+	for admin, expect := range map[string]string{
+		":10203":          "127.0.0.1:10203",
+		"127.0.0.1:10203": "127.0.0.1:10203",
+		"[::1]:10203":     "[::1]:10203",
+		"localhost:10203": "localhost:10203",
+	} {
+		addr, err := adminListenAddr(admin, "")
+		if err != nil || addr != expect {
+			t.Errorf("admin:%v,addr:%v,err:%v", admin, addr, err)
+			return
+		}
+	}
+	for _, admin := range []string{"0.0.0.0:10203", "192.168.1.1:10203", "xx", "[::]:10203"} {
+		if _, err := adminListenAddr(admin, ""); err == nil {
+			t.Errorf("admin:%v", admin)
+			return
+		}
+	}
+	if addr, err := adminListenAddr("0.0.0.0:10203", "abc"); err != nil || addr != "0.0.0.0:10203" {
+		t.Errorf("addr:%v,err:%v", addr, err)
+		return
+	}
+}
@@ -2,10 +2,9 @@ package main
 
 import (
 	"fmt"
-	"io/ioutil"
-	"os"
+	"net"
+	"net/http"
 	"path/filepath"
-	"strings"
 	"sync"
 
 	"github.com/sutils/webdebugger"
@@ -14,11 +13,23 @@ import (
 var proxyConf string
 var proxyConfDir string
 var proxyServer *webdebugger.SocksProxy
+var httpServer *webdebugger.HTTPProxy
+var muxServer *webdebugger.MuxProxy
+var transparentServer *webdebugger.TransparentProxy
 var debugger *webdebugger.Debuger
+var adminServer *http.Server
 
 type proxyConfig struct {
-	Socks5 string `json:"socks5"`
-	HTTP   string `json:"http"`
+	Listen      string `json:"listen"`
+	Socks5      string `json:"socks5"`
+	HTTP        string `json:"http"`
+	Transparent string `json:"transparent"`
+	TProxy      bool   `json:"tproxy"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	Admin       string `json:"admin"`
+	AdminUser   string `json:"admin_username"`
+	AdminPass   string `json:"admin_password"`
 }
 type clientConfig struct {
 	webdebugger.Config
@@ -34,8 +45,8 @@ func startProxy(c string) (err error) {
 		exitf(1)
 		return
 	}
-	if len(conf.Proxy.Socks5) < 1 {
-		webdebugger.ErrorLog("Client proxy.socks5 is required")
+	if len(conf.Proxy.Listen) < 1 && len(conf.Proxy.Socks5) < 1 && len(conf.Proxy.Transparent) < 1 {
+		webdebugger.ErrorLog("Client proxy.listen or proxy.socks5 or proxy.transparent is required")
 		exitf(1)
 		return
 	}
@@ -43,23 +54,112 @@ func startProxy(c string) (err error) {
 	proxyConfDir = filepath.Dir(proxyConf)
 	webdebugger.SetLogLevel(conf.LogLevel)
 	webdebugger.InfoLog("Client using config from %v", c)
+	for _, decorder := range conf.Decorder {
+		decorderType, _ := decorder["type"].(string)
+		if _, ok := decorder["ca_cert"]; decorderType == "CADecorder" && !ok {
+			decorder["ca_cert"], decorder["ca_key"] = caCertFile, caKeyFile
+		}
+	}
+	if len(conf.Proxy.Admin) > 0 && conf.Config.Capture == nil {
+		//the admin web ui browse the exchange in memory when capture is not configured
+		conf.Config.Capture = &webdebugger.CaptureConfig{}
+	}
 	debugger = webdebugger.NewDebuger(&conf.Config)
 	proxyServer = webdebugger.NewSocksProxy()
 	proxyServer.ProcConn = debugger.ProcConn
-	err = proxyServer.Listen(conf.Proxy.Socks5)
-	if err != nil {
-		webdebugger.ErrorLog("Client start proxy server fail with %v", err)
-		exitf(1)
-		return
-	}
+	proxyServer.ProcUDP = debugger.ProcUDP
+	proxyServer.Username = conf.Proxy.Username
+	proxyServer.Password = conf.Proxy.Password
+	httpServer = webdebugger.NewHTTPProxy()
+	httpServer.ProcConn = debugger.ProcConn
+	httpServer.Username = conf.Proxy.Username
+	httpServer.Password = conf.Proxy.Password
+	transparentServer = webdebugger.NewTransparentProxy()
+	transparentServer.ProcConn = debugger.ProcConn
+	transparentServer.TProxy = conf.Proxy.TProxy
 	// writeRuntimeVar()
 	wait := sync.WaitGroup{}
-	if len(conf.Proxy.HTTP) > 0 {
+	if len(conf.Proxy.Listen) > 0 {
+		muxServer = webdebugger.NewMuxProxy(proxyServer, httpServer)
+		//the mux tls connection is not accepted by tproxy, so it is using the REDIRECT way
+		muxTransparent := webdebugger.NewTransparentProxy()
+		muxTransparent.ProcConn = debugger.ProcConn
+		muxServer.TLS = muxTransparent.ProcTLSConn
+		err = muxServer.Listen(conf.Proxy.Listen)
+		if err != nil {
+			webdebugger.ErrorLog("Client start mux proxy server fail with %v", err)
+			exitf(1)
+			return
+		}
 		wait.Add(1)
+		go func() {
+			muxServer.Run()
+			wait.Done()
+		}()
+	}
+	if len(conf.Proxy.Socks5) > 0 {
+		err = proxyServer.Listen(conf.Proxy.Socks5)
+		if err != nil {
+			webdebugger.ErrorLog("Client start proxy server fail with %v", err)
+			exitf(1)
+			return
+		}
+		wait.Add(1)
+		go func() {
+			proxyServer.Run()
+			wait.Done()
+		}()
+	}
+	if len(conf.Proxy.HTTP) > 0 {
+		err = httpServer.Listen(conf.Proxy.HTTP)
+		if err != nil {
+			webdebugger.ErrorLog("Client start http proxy server fail with %v", err)
+			exitf(1)
+			return
+		}
 		proxyServer.HTTPUpstream = conf.Proxy.HTTP
+		wait.Add(1)
+		go func() {
+			httpServer.Run()
+			wait.Done()
+		}()
+	}
+	if len(conf.Proxy.Transparent) > 0 {
+		err = transparentServer.Listen(conf.Proxy.Transparent)
+		if err != nil {
+			webdebugger.ErrorLog("Client start transparent proxy server fail with %v", err)
+			exitf(1)
+			return
+		}
+		wait.Add(1)
+		go func() {
+			transparentServer.Run()
+			wait.Done()
+		}()
+	}
+	if len(conf.Proxy.Admin) > 0 {
+		admin := webdebugger.NewDebugerAdmin(debugger)
+		admin.Username, admin.Password = conf.Proxy.AdminUser, conf.Proxy.AdminPass
+		var addr string
+		addr, err = adminListenAddr(conf.Proxy.Admin, conf.Proxy.AdminUser)
+		if err != nil {
+			webdebugger.ErrorLog("Client start admin web ui fail with %v", err)
+			exitf(1)
+			return
+		}
+		admin.Hosts = []string{addr}
+		var listener net.Listener
+		listener, err = net.Listen("tcp", addr)
+		if err != nil {
+			webdebugger.ErrorLog("Client start admin web ui fail with %v", err)
+			exitf(1)
+			return
+		}
+		webdebugger.InfoLog("Client admin web ui is listened on %v", addr)
+		adminServer = &http.Server{Handler: admin}
+		wait.Add(1)
 		go func() {
-			xerr := runPrivoxy(conf.Proxy.HTTP)
-			webdebugger.WarnLog("Client the privoxy on %v is stopped by %v", conf.Proxy.HTTP, xerr)
+			adminServer.Serve(listener)
 			wait.Done()
 		}()
 	}
@@ -69,68 +169,48 @@ func startProxy(c string) (err error) {
 		wait.Done()
 	}()
 	go handlerClientKill()
-	proxyServer.Run()
-	webdebugger.InfoLog("Client all listener is stopped")
 	wait.Wait()
+	webdebugger.InfoLog("Client all listener is stopped")
+	return
+}
+
+//adminListenAddr will return the admin address which is listened on loopback when host is not setted,
+//the non-loopback address is refused when admin_username is not setted, because the captured credential is served by admin
+func adminListenAddr(admin, username string) (addr string, err error) {
+	host, port, err := net.SplitHostPort(admin)
+	if err != nil {
+		return
+	}
+	if len(host) < 1 {
+		host = "127.0.0.1"
+	}
+	ip := net.ParseIP(host)
+	if len(username) < 1 && host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		err = fmt.Errorf("admin_username is required to listen admin on %v", admin)
+		return
+	}
+	addr = net.JoinHostPort(host, port)
 	return
 }
 
 func stopClient() {
 	webdebugger.InfoLog("Client stopping client listener")
-	if proxyServer != nil {
+	if muxServer != nil && muxServer.Listener != nil {
+		muxServer.Close()
+	}
+	if proxyServer != nil && proxyServer.Listener != nil {
 		proxyServer.Close()
 	}
-	if privoxyRunner != nil && privoxyRunner.Process != nil {
-		privoxyRunner.Process.Kill()
+	if httpServer != nil && httpServer.Listener != nil {
+		httpServer.Close()
+	}
+	if transparentServer != nil && transparentServer.Listener != nil {
+		transparentServer.Close()
+	}
+	if adminServer != nil {
+		adminServer.Close()
 	}
 	if debugger != nil {
 		debugger.Close()
 	}
 }
-
-const (
-	//PrivoxyTmpl is privoxy template
-	PrivoxyTmpl = `
-listen-address {http}
-toggle  1
-enable-remote-toggle 1
-enable-remote-http-toggle 1
-enable-edit-actions 0
-enforce-blocks 0
-buffer-limit 4096
-forwarded-connect-retries  0
-accept-intercepted-requests 0
-allow-cgi-request-crunching 0
-split-large-forms 0
-keep-alive-timeout 5
-socket-timeout 60
-
-forward-socks5 / {socks5} .
-forward         192.168.*.*/     .
-forward         10.*.*.*/        .
-forward         127.*.*.*/       .
-
-	`
-)
-
-func writePrivoxyConf(confFile, httpAddr, socksAddr string) (err error) {
-	data := PrivoxyTmpl
-	data = strings.Replace(data, "{http}", httpAddr, 1)
-	data = strings.Replace(data, "{socks5}", socksAddr, 1)
-	err = ioutil.WriteFile(confFile, []byte(data), os.ModePerm)
-	return
-}
-
-func runPrivoxy(httpAddr string) (err error) {
-	proxyServerParts := strings.SplitN(proxyServer.Addr().String(), ":", -1)
-	socksAddr := fmt.Sprintf("127.0.0.1:%v", proxyServerParts[len(proxyServerParts)-1])
-	webdebugger.InfoLog("Client start privoxy by listening http proxy on %v and forwarding to %v", httpAddr, socksAddr)
-	confFile := filepath.Join(workDir, "privoxy.conf")
-	err = writePrivoxyConf(confFile, httpAddr, socksAddr)
-	if err != nil {
-		webdebugger.WarnLog("Client save privoxy config to %v fail with %v", confFile, err)
-		return
-	}
-	err = runPrivoxyNative(confFile)
-	return
-}
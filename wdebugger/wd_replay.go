@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sutils/webdebugger"
+)
+
+var replayOutput io.Writer = os.Stdout
+
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ",")
+}
+
+func (h *headerFlags) Set(value string) error {
+	*h = append(*h, value)
+	return nil
+}
+
+//runReplay will replay the captured exchange by the admin api of running client and print the difference of response
+func runReplay(args []string) (err error) {
+	var server, user, body, forward string
+	var headers headerFlags
+	options := &webdebugger.ReplayOptions{Header: map[string]string{}}
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.StringVar(&server, "s", "", "the admin web ui address of client, default is proxy.admin of client configure")
+	flags.StringVar(&user, "u", "", "the admin username:password")
+	flags.StringVar(&options.Method, "X", "", "the request method to replace")
+	flags.StringVar(&options.URL, "url", "", "the request uri or full url to replace")
+	flags.Var(&headers, "H", "the request header to set like 'Name: value', the header is removed when value is empty")
+	flags.StringVar(&body, "d", "", "the request body to replace, @file to read from file")
+	flags.StringVar(&forward, "forward", "", "the upstream to forward, it must be configured on hosts")
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+	if flags.NArg() < 1 {
+		err = fmt.Errorf("exchange id is required")
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		flags.Usage()
+		return
+	}
+	if len(server) < 1 {
+		conf := &clientConfig{}
+		if webdebugger.ReadJSON(argConf, conf) == nil {
+			server = conf.Proxy.Admin
+		}
+	}
+	if len(server) < 1 {
+		err = fmt.Errorf("admin server is required")
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	if !strings.Contains(server, "://") {
+		server = "http://" + server
+	}
+	for _, header := range headers {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) != 2 || len(strings.TrimSpace(parts[0])) < 1 {
+			err = fmt.Errorf("invalid header %v", header)
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return
+		}
+		options.Header[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "d" {
+			options.Body = &body
+		}
+	})
+	if options.Body != nil && strings.HasPrefix(body, "@") {
+		var data []byte
+		data, err = ioutil.ReadFile(strings.TrimPrefix(body, "@"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "read body fail with %v\n", err)
+			return
+		}
+		body = string(data)
+	}
+	options.Forward = forward
+	data, _ := json.Marshal(options)
+	req, _ := http.NewRequest("POST", strings.TrimSuffix(server, "/")+"/api/replay?id="+flags.Arg(0), bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	if parts := strings.SplitN(user, ":", 2); len(parts) == 2 {
+		req.SetBasicAuth(parts[0], parts[1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay fail with %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+	data, _ = ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("replay fail with %v:%v", resp.StatusCode, strings.TrimSpace(string(data)))
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	result := map[string]*webdebugger.HAREntry{}
+	err = json.Unmarshal(data, &result)
+	if err != nil || result["original"] == nil || result["replay"] == nil {
+		err = fmt.Errorf("invalid replay response %v", string(data))
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	printReplay(result["original"], result["replay"])
+	return
+}
+
+//printReplay will print the difference of original and replay response
+func printReplay(original, replay *webdebugger.HAREntry) {
+	for _, entry := range []*webdebugger.HAREntry{original, replay} {
+		fmt.Fprintf(replayOutput, "#%v %v %v -> %v %v, %v bytes, %.1fms\n", entry.ID, entry.Request.Method, entry.Request.URL,
+			entry.Response.Status, entry.Response.StatusText, entry.Response.Content.Size, entry.Time)
+	}
+	headers := map[string][]string{}
+	for i, entry := range []*webdebugger.HAREntry{original, replay} {
+		for _, header := range entry.Response.Headers {
+			if len(headers[header.Name]) < 1 {
+				headers[header.Name] = make([]string, 2)
+			}
+			headers[header.Name][i] = header.Value
+		}
+	}
+	names := []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(replayOutput, "\n---Header---\n")
+	for _, name := range names {
+		if vals := headers[name]; vals[0] != vals[1] {
+			fmt.Fprintf(replayOutput, "%v\t%v -> %v\n", name, vals[0], vals[1])
+		}
+	}
+	fmt.Fprintf(replayOutput, "\n---Body---\n")
+	if original.Response.Content.Text == replay.Response.Content.Text {
+		fmt.Fprintf(replayOutput, "same\n")
+	} else {
+		fmt.Fprintf(replayOutput, "%v\n", replay.Response.Content.Text)
+	}
+}
@@ -1,17 +1,27 @@
 package main
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
+	"os"
 	"path/filepath"
 
 	"github.com/sutils/webdebugger"
 )
 
-//ServerConf is pojo for server configure
+//ServerConf is pojo for server configure, the server is on https when TLSCert/TLSKey is setted
+//and the client certificate is required when ClientCA is setted
 type ServerConf struct {
-	Listen   string                   `json:"listen"`
-	Certs    []map[string]interface{} `json:"certs"`
-	LogLevel int                      `json:"log"`
+	Listen      string                   `json:"listen"`
+	TLSCert     string                   `json:"tls_cert"`
+	TLSKey      string                   `json:"tls_key"`
+	ClientCA    string                   `json:"client_ca"`
+	Tokens      []*webdebugger.AuthToken `json:"tokens"`
+	RequireWrap bool                     `json:"require_wrap"`
+	Store       map[string]interface{}   `json:"store"`
+	Certs       []map[string]interface{} `json:"certs"`
+	LogLevel    int                      `json:"log"`
 }
 
 var serverConf string
@@ -26,10 +36,64 @@ func startServer(c string) (err error) {
 		exitf(1)
 		return
 	}
+	if len(conf.ClientCA) > 0 && (len(conf.TLSCert) < 1 || len(conf.TLSKey) < 1) {
+		webdebugger.ErrorLog("Server the client_ca is configured, but tls_cert/tls_key is not configured")
+		exitf(1)
+		return
+	}
 	serverConf = c
 	serverConfDir = filepath.Dir(serverConf)
 	webdebugger.SetLogLevel(conf.LogLevel)
 	certCenter = webdebugger.NewTLSCertCenter(conf.Certs...)
-	http.ListenAndServe(conf.Listen, certCenter)
+	certCenter.Tokens = conf.Tokens
+	certCenter.RequireWrap = conf.RequireWrap
+	certCenter.CertDir = filepath.Join(serverConfDir, "certs")
+	if conf.Store != nil {
+		certCenter.Store, err = webdebugger.NewCertStore(conf.Store)
+		if err != nil {
+			webdebugger.ErrorLog("Server create cert store by %v fail with %v", conf.Store, err)
+			exitf(1)
+			return
+		}
+	}
+	certCenter.Persist = saveServerCerts
+	server := &http.Server{Addr: conf.Listen, Handler: certCenter}
+	if len(conf.TLSCert) < 1 {
+		err = server.ListenAndServe()
+		return
+	}
+	if len(conf.ClientCA) > 0 {
+		server.TLSConfig, err = webdebugger.NewClientAuthTLSConfig(conf.ClientCA)
+		if err != nil {
+			webdebugger.ErrorLog("Server load client ca from %v fail with %v", conf.ClientCA, err)
+			exitf(1)
+			return
+		}
+	}
+	webdebugger.InfoLog("Server listen cert center on https %v", conf.Listen)
+	err = server.ListenAndServeTLS(conf.TLSCert, conf.TLSKey)
+	return
+}
+
+//saveServerCerts will save the host configure to server configure file and keep the other configure
+func saveServerCerts(certs []map[string]interface{}) (err error) {
+	conf := map[string]interface{}{}
+	err = webdebugger.ReadJSON(serverConf, &conf)
+	if err != nil {
+		return
+	}
+	conf["certs"] = certs
+	data, err := json.MarshalIndent(conf, "", "    ")
+	if err != nil {
+		return
+	}
+	tmp := serverConf + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err == nil {
+		err = os.Rename(tmp, serverConf)
+	}
+	if err == nil {
+		webdebugger.InfoLog("Server save %v host config to %v", len(certs), serverConf)
+	}
 	return
 }